@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+// aclList is a named set of aggregated networks such as every network located in a country
+type aclList struct {
+	name     string
+	networks []Network
+}
+
+func exportACLCommand(args []string) {
+	flags := flag.NewFlagSet("export-acl", flag.ContinueOnError)
+	countries := flags.String("countries", "", "comma separated ISO country codes (default every country)")
+	euOnly := flags.Bool("eu", false, "export a single list of the networks located in the European Union")
+	format := flags.String("format", "text", "text, ipset, nftables, iptables, nginx or haproxy")
+	family := flags.String("family", "both", "4, 6 or both")
+	action := flags.String("action", "drop", "iptables target for matching networks: accept or drop")
+	output := flags.String("o", "", "write to a file instead of stdout")
+	output6 := flags.String("o6", "", "write the ip6tables rules to this file, required by the iptables format with both families")
+	treeFile := treeFlag(flags)
+	parseFlags(flags, args)
+	if err := checkACLFlags(*format, *family, *output6); err != nil {
+		log.Print(err)
+		exit(exitUsage)
+	}
+	var codes []string
+	if *countries != "" {
+		codes = strings.Split(strings.ToUpper(*countries), ",")
+	}
+	lists := collectACLs(loadTree(*treeFile), codes, *euOnly, *family)
+	if *output6 != "" {
+		writeACLFile(*output, *format, *action, "4", lists)
+		writeACLFile(*output6, *format, *action, "6", lists)
+		return
+	}
+	writeACLFile(*output, *format, *action, *family, lists)
+}
+
+// checkACLFlags reports flag combinations that cannot be exported
+func checkACLFlags(format, family, output6 string) error {
+	if family != "4" && family != "6" && family != "both" {
+		return fmt.Errorf("family '%v' is not 4, 6 or both", family)
+	}
+	if output6 != "" && (format != "iptables" || family != "both") {
+		return errors.New("-o6 is only used by the iptables format with both families")
+	}
+	if format == "iptables" && family == "both" && output6 == "" {
+		return errors.New("iptables-restore and ip6tables-restore each take one family so use -o6 or a single -family")
+	}
+	return nil
+}
+
+// writeACLFile writes the lists to the file, or to stdout when the filename is empty
+func writeACLFile(filename, format, action, family string, lists []aclList) {
+	w := os.Stdout
+	if filename != "" {
+		f, err := os.Create(filename)
+		if err != nil {
+			fatalf("unable to export acl because: %v", err)
+		}
+		defer f.Close()
+		w = f
+	}
+	buffered := bufio.NewWriter(w)
+	if err := writeACL(buffered, format, action, family, lists); err != nil {
+		fatalf("unable to export acl because: %v", err)
+	}
+	if err := buffered.Flush(); err != nil {
+		fatalf("unable to export acl because: %v", err)
+	}
+}
+
+func collectACLs(tree *Tree, countries []string, euOnly bool, family string) []aclList {
+	if len(countries) == 0 {
+		for country := range tree.locations().countries {
+			if country != "" { // locations that only name a continent
+				countries = append(countries, country)
+			}
+		}
+		sort.Strings(countries)
+	}
+	var lists []aclList
+	if euOnly {
+		selected := map[string]bool{}
+		for _, country := range countries {
+			selected[country] = true
+		}
+		var nodes []*Node
+		for _, n := range tree.NetworksInEU() {
+			if selected[n.GeoPosition.Location.CountryISO] {
+				nodes = append(nodes, n)
+			}
+		}
+		lists = append(lists, aclList{"EU", AggregateNetworks(nodes)})
+	} else {
+		for _, country := range countries {
+			lists = append(lists, aclList{country, AggregateNetworks(tree.NetworksByCountry(country))})
+		}
+	}
+	for i := range lists {
+		var networks []Network
+		for _, network := range lists[i].networks {
+			if family == "both" || (family == "4" && !network.IsV6()) || (family == "6" && network.IsV6()) {
+				networks = append(networks, network)
+			}
+		}
+		lists[i].networks = networks
+	}
+	return lists
+}
+
+// writeACL writes the lists in the format. Formats that keep IPv4 and IPv6 networks apart only
+// write the families selected by family, which is 4, 6 or both. The iptables format writes a
+// single family.
+func writeACL(w io.Writer, format, action, family string, lists []aclList) error {
+	var families []string
+	if family != "6" {
+		families = append(families, "inet")
+	}
+	if family != "4" {
+		families = append(families, "inet6")
+	}
+	switch format {
+	case "text":
+		for _, list := range lists {
+			fmt.Fprintf(w, "# %v\n", list.name)
+			for _, network := range list.networks {
+				fmt.Fprintln(w, network)
+			}
+		}
+	case "ipset":
+		for _, list := range lists {
+			for _, family := range families {
+				name := aclSetName("networktree-", list.name, family, "-")
+				fmt.Fprintf(w, "create %v hash:net family %v -exist\nflush %v\n", name, family, name)
+				for _, network := range list.networks {
+					if network.IsV6() == (family == "inet6") {
+						fmt.Fprintf(w, "add %v %v\n", name, network)
+					}
+				}
+			}
+		}
+	case "nftables":
+		fmt.Fprintln(w, "add table inet networktree")
+		for _, list := range lists {
+			for _, family := range families {
+				name := aclSetName("", list.name, family, "_")
+				addrType := "ipv4_addr"
+				if family == "inet6" {
+					addrType = "ipv6_addr"
+				}
+				fmt.Fprintf(w, "add set inet networktree %v { type %v; flags interval; }\n", name, addrType)
+				var elements []string
+				for _, network := range list.networks {
+					if network.IsV6() == (family == "inet6") {
+						elements = append(elements, network.String())
+					}
+				}
+				if len(elements) > 0 {
+					fmt.Fprintf(w, "add element inet networktree %v { %v }\n", name, strings.Join(elements, ", "))
+				}
+			}
+		}
+	case "iptables":
+		target := strings.ToUpper(action)
+		if target != "ACCEPT" && target != "DROP" {
+			return fmt.Errorf("action '%v' is not accept or drop", action)
+		}
+		if len(families) != 1 {
+			return errors.New("iptables-restore and ip6tables-restore each take one family")
+		}
+		fmt.Fprintln(w, "*filter")
+		for _, list := range lists {
+			fmt.Fprintf(w, ":NETWORKTREE-%v - [0:0]\n", list.name)
+		}
+		for _, list := range lists {
+			for _, network := range list.networks {
+				if network.IsV6() == (families[0] == "inet6") {
+					fmt.Fprintf(w, "-A NETWORKTREE-%v -s %v -j %v\n", list.name, network, target)
+				}
+			}
+		}
+		fmt.Fprintln(w, "COMMIT")
+	case "nginx":
+		fmt.Fprintln(w, "geo $networktree_country {\n    default \"\";")
+		for _, list := range lists {
+			for _, network := range list.networks {
+				fmt.Fprintf(w, "    %v %v;\n", network, list.name)
+			}
+		}
+		fmt.Fprintln(w, "}")
+	case "haproxy":
+		for _, list := range lists {
+			for _, network := range list.networks {
+				fmt.Fprintf(w, "%v %v\n", network, list.name)
+			}
+		}
+	default:
+		return fmt.Errorf("format '%v' is not supported", format)
+	}
+	return nil
+}
+
+func aclSetName(prefix, name, family, separator string) string {
+	if family == "inet6" {
+		return prefix + strings.ToLower(name) + separator + "v6"
+	}
+	return prefix + strings.ToLower(name) + separator + "v4"
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCollectACLs(t *testing.T) {
+	tree := NewTree(4)
+	tree.insert(&GeoPosition{Location: &GeoLocation{CountryISO: "FR", IsPartOfEU: true}},
+		mustParseNetwork("192.0.2.0/25"), mustParseNetwork("192.0.2.128/25"), mustParseNetwork("2001:db8::/32"))
+	tree.insert(&GeoPosition{Location: &GeoLocation{CountryISO: "DE", IsPartOfEU: true}}, mustParseNetwork("192.0.3.0/24"))
+	tree.insert(&GeoPosition{Location: &GeoLocation{CountryISO: "CH"}}, mustParseNetwork("198.51.100.0/24"))
+	lists := collectACLs(tree, nil, false, "4")
+	if len(lists) != 3 || lists[0].name != "CH" || lists[2].name != "FR" || len(lists[2].networks) != 1 {
+		t.Error("unexpected country lists", lists)
+	}
+	lists = collectACLs(tree, nil, true, "both")
+	if len(lists) != 1 || len(lists[0].networks) != 2 || lists[0].networks[0] != mustParseNetwork("192.0.2.0/23") {
+		t.Error("unexpected EU list", lists)
+	}
+}
+
+func TestWriteACL(t *testing.T) {
+	lists := []aclList{{"BR", []Network{mustParseNetwork("192.0.2.0/24"), mustParseNetwork("2001:db8::/32")}}}
+	expected := map[string]string{
+		"text": "# BR\n192.0.2.0/24\n2001:db8::/32\n",
+		"ipset": "create networktree-br-v4 hash:net family inet -exist\nflush networktree-br-v4\n" +
+			"add networktree-br-v4 192.0.2.0/24\n" +
+			"create networktree-br-v6 hash:net family inet6 -exist\nflush networktree-br-v6\n" +
+			"add networktree-br-v6 2001:db8::/32\n",
+		"nftables": "add table inet networktree\n" +
+			"add set inet networktree br_v4 { type ipv4_addr; flags interval; }\n" +
+			"add element inet networktree br_v4 { 192.0.2.0/24 }\n" +
+			"add set inet networktree br_v6 { type ipv6_addr; flags interval; }\n" +
+			"add element inet networktree br_v6 { 2001:db8::/32 }\n",
+		"nginx":   "geo $networktree_country {\n    default \"\";\n    192.0.2.0/24 BR;\n    2001:db8::/32 BR;\n}\n",
+		"haproxy": "192.0.2.0/24 BR\n2001:db8::/32 BR\n",
+	}
+	for format, output := range expected {
+		var b bytes.Buffer
+		if err := writeACL(&b, format, "drop", "both", lists); err != nil || b.String() != output {
+			t.Errorf("%v format wrote %q with error %v", format, b.String(), err)
+		}
+	}
+	var b bytes.Buffer
+	if err := writeACL(&b, "iptables", "drop", "both", lists); err == nil {
+		t.Errorf("iptables format wrote both families into %q", b.String())
+	}
+	b.Reset()
+	if err := writeACL(&b, "iptables", "drop", "6", lists); err != nil || b.String() != "*filter\n"+
+		":NETWORKTREE-BR - [0:0]\n-A NETWORKTREE-BR -s 2001:db8::/32 -j DROP\nCOMMIT\n" {
+		t.Errorf("iptables format wrote %q with error %v", b.String(), err)
+	}
+	b.Reset()
+	lists[0].networks = lists[0].networks[:1]
+	if err := writeACL(&b, "iptables", "accept", "4", lists); err != nil || strings.Contains(b.String(), "ip6tables") ||
+		!strings.Contains(b.String(), "-A NETWORKTREE-BR -s 192.0.2.0/24 -j ACCEPT\n") || strings.Contains(b.String(), "2001:db8") {
+		t.Errorf("iptables format wrote %q with error %v", b.String(), err)
+	}
+	b.Reset()
+	if err := writeACL(&b, "ipset", "drop", "4", lists); err != nil || strings.Contains(b.String(), "inet6") {
+		t.Errorf("ipset format wrote %q with error %v", b.String(), err)
+	}
+}
+
+func TestCheckACLFlags(t *testing.T) {
+	for _, flags := range [][3]string{{"iptables", "both", ""}, {"ipset", "both", "rules.v6"},
+		{"iptables", "4", "rules.v6"}, {"text", "7", ""}} {
+		if err := checkACLFlags(flags[0], flags[1], flags[2]); err == nil {
+			t.Errorf("%q was accepted", flags)
+		}
+	}
+	for _, flags := range [][3]string{{"iptables", "both", "rules.v6"}, {"iptables", "4", ""},
+		{"iptables", "6", ""}, {"nftables", "both", ""}} {
+		if err := checkACLFlags(flags[0], flags[1], flags[2]); err != nil {
+			t.Errorf("%q was refused: %v", flags, err)
+		}
+	}
+}
+
+func TestExportContinentOnlyLocations(t *testing.T) {
+	writeGeoliteFixtures(t, []string{"45.0.0.0/16,1,,,0,0,,48.85,2.35,20", "46.0.0.0/16,4,,,0,0,,47.9,8.0,1000"}, nil)
+	tree := NewTree(16)
+	ingestGeoliteData(tree)
+	if n := tree.findClosestSupernet(mustParseNetwork("46.0.0.1/32"), tree.Roots); n == nil || n.GeoPosition.Location.CountryISO != "" {
+		t.Fatal("the continent-only location was not ingested")
+	}
+	lists := collectACLs(tree, nil, false, "both")
+	if len(lists) != 1 || lists[0].name != "FR" {
+		t.Fatalf("unexpected country lists %v", lists)
+	}
+	for _, format := range []string{"nginx", "haproxy", "iptables"} {
+		var b bytes.Buffer
+		if err := writeACL(&b, format, "drop", "4", lists); err != nil || strings.Contains(b.String(), " ;") ||
+			strings.Contains(b.String(), "NETWORKTREE- ") || strings.Contains(b.String(), "46.0.0.0") {
+			t.Errorf("%v format wrote %q with error %v", format, b.String(), err)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+)
+
+// ASNRecord describes a range of autonomous system numbers delegated by a registry
+type ASNRecord struct {
+	First      uint32      `json:"first"`
+	Last       uint32      `json:"last"`
+	CountryISO string      `json:"countryISO"` // empty when the registry did not assign a country
+	Allocation *Allocation `json:"allocation"`
+}
+
+func newASNRecord(source Source, lineColumns []string) (ASNRecord, error) {
+	first, err := strconv.ParseUint(lineColumns[3], 10, 32)
+	if err != nil {
+		return ASNRecord{}, fmt.Errorf("ASN '%v' is not valid", lineColumns[3])
+	}
+	count, err := strconv.ParseUint(lineColumns[4], 10, 32)
+	if err != nil || count == 0 || first+count-1 > 1<<32-1 {
+		return ASNRecord{}, fmt.Errorf("ASN count '%v' is not valid", lineColumns[4])
+	}
+	record := ASNRecord{
+		First:      uint32(first),
+		Last:       uint32(first + count - 1),
+		Allocation: newAllocation(source, lineColumns),
+	}
+	if coarseCountryPositions[lineColumns[1]] != nil {
+		record.CountryISO = lineColumns[1]
+	}
+	return record, nil
+}
+
+// LookupASN returns the delegation that contains the autonomous system number
+func (tree *Tree) LookupASN(asn uint32) (ASNRecord, bool) {
+	i := sort.Search(len(tree.ASNs), func(i int) bool { return tree.ASNs[i].Last >= asn })
+	if i < len(tree.ASNs) && tree.ASNs[i].First <= asn {
+		return tree.ASNs[i], true
+	}
+	return ASNRecord{}, false
+}
+
+// ASNsByOpaqueID returns the autonomous system delegations whose records share the opaque-id of a holder
+// in the registry
+func (tree *Tree) ASNsByOpaqueID(registry Source, opaqueID string) []ASNRecord {
+	if opaqueID == "" {
+		return nil
+	}
+	return tree.asnHolders()[holderKey{registry, opaqueID}]
+}
+
+// asnHolders only takes the write lock to build the index so that concurrent lookups are not serialised
+func (tree *Tree) asnHolders() map[holderKey][]ASNRecord {
+	tree.mtx.RLock()
+	index := tree.asnHolderIndex
+	tree.mtx.RUnlock()
+	if index != nil {
+		return index
+	}
+	tree.mtx.Lock()
+	defer tree.mtx.Unlock()
+	if tree.asnHolderIndex == nil {
+		tree.asnHolderIndex = map[holderKey][]ASNRecord{}
+		for _, record := range tree.ASNs {
+			if record.Allocation.OpaqueID != "" {
+				key := holderKey{record.Allocation.Registry, record.Allocation.OpaqueID}
+				tree.asnHolderIndex[key] = append(tree.asnHolderIndex[key], record)
+			}
+		}
+	}
+	return tree.asnHolderIndex
+}
+
+// LookupASNs returns the autonomous system delegations held by the organisation that holds the address.
+// Delegated files do not record which prefixes an autonomous system announces, so this is the closest link.
+func (tree *Tree) LookupASNs(address net.IP) []ASNRecord {
+	if tree.Registry == nil {
+		return nil
+	}
+	n := tree.Registry.lookupAllocation(address, nil)
+	if n == nil || n.GeoPosition.Allocation == nil {
+		return nil
+	}
+	return tree.ASNsByOpaqueID(n.GeoPosition.Allocation.Registry, n.GeoPosition.Allocation.OpaqueID)
+}
+
+// NetworksByASN returns the delegated networks held by the same organisation as the autonomous system
+func (tree *Tree) NetworksByASN(asn uint32) []*Node {
+	record, found := tree.LookupASN(asn)
+	if !found || record.Allocation.OpaqueID == "" {
+		return nil
+	}
+	return tree.NetworksByOpaqueID(record.Allocation.Registry, record.Allocation.OpaqueID)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLookupASN(t *testing.T) {
+	writeGeoliteFixtures(t, nil, nil)
+	writeDelegatedFixtures(t, map[string]string{
+		afrinicPath: "2|afrinic|20190107|5|00000000|20190107|00000\n" +
+			"afrinic|*|asn|*|3|summary\n" +
+			"afrinic|*|ipv4|*|1|summary\n" +
+			"afrinic|*|ipv6|*|1|summary\n" +
+			"afrinic|ZA|asn|1228|1|19910301|allocated|F36B9F4B\n" +
+			"afrinic|ZZ|asn|5536|4||available|\n" +
+			"afrinic|KE|asn|2018|1|19920101|allocated|F3675D0B\n" +
+			"afrinic|ZA|ipv4|41.0.0.0|65536|20070409|allocated|F36B9F4B\n" +
+			"afrinic|ZA|ipv6|2c0f:f000::|32|20070410|allocated|F36B9F4B\n",
+		lacnicPath: "2|lacnic|20190107|2|00000000|20190107|00000\n" +
+			"lacnic|*|asn|*|1|summary\n" +
+			"lacnic|*|ipv4|*|1|summary\n" +
+			"lacnic|*|ipv6|*|0|summary\n" +
+			"lacnic|BR|asn|28000|1|20000101|allocated|F36B9F4B\n" +
+			"lacnic|BR|ipv4|200.0.0.0|256|20000101|allocated|F36B9F4B\n",
+	})
+	tree := NewTree(16)
+	ingestGeoliteData(tree)
+	ingestRIRData(tree)
+
+	record, found := tree.LookupASN(1228)
+	if !found || record.CountryISO != "ZA" || record.Allocation.Registry != SourceAFRINIC ||
+		record.Allocation.OpaqueID != "F36B9F4B" || record.Allocation.Date.Year() != 1991 {
+		t.Errorf("unexpected record for AS1228: %+v", record)
+	}
+	if record, found := tree.LookupASN(5538); !found || record.First != 5536 || record.Last != 5539 ||
+		record.CountryISO != "" || record.Allocation.Status != StatusAvailable {
+		t.Errorf("unexpected record for AS5538: %+v", record)
+	}
+	for _, asn := range []uint32{0, 1229, 2017, 5540} {
+		if _, found := tree.LookupASN(asn); found {
+			t.Errorf("AS%v should not have been found", asn)
+		}
+	}
+	networks := tree.NetworksByASN(1228)
+	if len(networks) != 2 || networks[0].Network != mustParseNetwork("41.0.0.0/16") ||
+		networks[1].Network != mustParseNetwork("2c0f:f000::/32") {
+		t.Errorf("unexpected networks for AS1228: %v", networks)
+	}
+	if len(tree.NetworksByASN(2018)) != 0 || len(tree.NetworksByASN(5536)) != 0 {
+		t.Error("autonomous systems without prefixes should not return networks")
+	}
+	if records := tree.ASNsByOpaqueID(SourceAFRINIC, "F36B9F4B"); len(records) != 1 || records[0].First != 1228 {
+		t.Errorf("unexpected autonomous systems for the holder: %v", records)
+	}
+	if records := tree.ASNsByOpaqueID(SourceLACNIC, "F36B9F4B"); len(records) != 1 || records[0].First != 28000 {
+		t.Errorf("holders sharing an opaque-id in different registries were merged: %v", records)
+	}
+	if networks := tree.NetworksByASN(28000); len(networks) != 1 || networks[0].Network != mustParseNetwork("200.0.0.0/24") {
+		t.Errorf("unexpected networks for AS28000: %v", networks)
+	}
+
+	recorder := httptest.NewRecorder()
+	newServeMux(tree).ServeHTTP(recorder, httptest.NewRequest("GET", "/asn?n=AS1228", nil))
+	var result struct {
+		CountryISO string   `json:"countryISO"`
+		Networks   []string `json:"networks"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.CountryISO != "ZA" || len(result.Networks) != 2 {
+		t.Errorf("unexpected /asn response: %v", recorder.Body.String())
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// BulkBuild populates an empty Tree in a single pass. The next function must return networks
+// sorted by address with supernets ahead of their subnets and report false once exhausted.
+func (tree *Tree) BulkBuild(next func() (Network, *GeoPosition, bool)) error {
+	if tree.Size > 0 {
+		return errors.New("bulk build requires an empty tree")
+	}
+	roots, rootsV6, size, err := tree.buildNodes(next)
+	if err != nil {
+		return err
+	}
+	tree.Roots, tree.RootsV6, tree.Size = roots, rootsV6, size
+	tree.modified()
+	return nil
+}
+
+func (tree *Tree) buildNodes(next func() (Network, *GeoPosition, bool)) (roots, rootsV6 []*Node, size int, err error) {
+	var stack []*Node
+	var previous *Node
+	for {
+		network, geoPosition, ok := next()
+		if !ok {
+			break
+		}
+		if previous != nil && previous.Network.IsV6() == network.IsV6() && network.Before(previous.Network) {
+			return nil, nil, 0, fmt.Errorf("network %v is not sorted after %v", network, previous.Network)
+		}
+		for len(stack) > 0 && !stack[len(stack)-1].Network.Contains(network) {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) > 0 && stack[len(stack)-1].Network == network {
+			if stack[len(stack)-1].GeoPosition == nil {
+				stack[len(stack)-1].GeoPosition = geoPosition
+			}
+			continue
+		}
+		newNode := &Node{Network: network, GeoPosition: geoPosition}
+		if len(stack) > 0 {
+			newNode.Parent = stack[len(stack)-1]
+			newNode.Parent.Children = append(newNode.Parent.Children, newNode)
+		} else if !network.IsV6() {
+			roots = append(roots, newNode)
+		} else {
+			rootsV6 = append(rootsV6, newNode)
+		}
+		stack = append(stack, newNode)
+		previous = newNode
+		size++
+	}
+	roots = tree.balanceNodes(nil, Network{}, roots, &size)
+	rootsV6 = tree.balanceNodes(nil, Network{isV6: true}, rootsV6, &size)
+	return roots, rootsV6, size, nil
+}
+
+// balanceNodes mirrors splitParent by adding synthetic nodes wherever the fan-out exceeds Precision
+func (tree *Tree) balanceNodes(parent *Node, network Network, nodes []*Node, size *int) []*Node {
+	for _, n := range nodes {
+		n.Children = tree.balanceNodes(n, n.Network, n.Children, size)
+	}
+	return tree.splitNodes(parent, network, nodes, size)
+}
+
+func (tree *Tree) splitNodes(parent *Node, network Network, nodes []*Node, size *int) []*Node {
+	if len(nodes) <= tree.Precision {
+		return nodes
+	}
+	lower, upper, ok := network.halves()
+	if !ok {
+		return nodes
+	}
+	idx := 0
+	for idx < len(nodes) && lower.Contains(nodes[idx].Network) {
+		idx++
+	}
+	var result []*Node
+	for _, half := range []struct {
+		network Network
+		nodes   []*Node
+	}{{lower, nodes[:idx:idx]}, {upper, nodes[idx:]}} {
+		switch len(half.nodes) {
+		case 0:
+		case 1:
+			result = append(result, half.nodes[0])
+		default:
+			synthetic := &Node{Network: half.network, Parent: parent}
+			for _, n := range half.nodes {
+				n.Parent = synthetic
+			}
+			synthetic.Children = tree.splitNodes(synthetic, half.network, half.nodes, size)
+			result = append(result, synthetic)
+			*size++
+		}
+	}
+	return result
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func sliceIterator(networks []Network, positions []*GeoPosition) func() (Network, *GeoPosition, bool) {
+	i := 0
+	return func() (Network, *GeoPosition, bool) {
+		if i >= len(networks) {
+			return Network{}, nil, false
+		}
+		i++
+		return networks[i-1], positions[i-1], true
+	}
+}
+
+func populatedSupernet(tree *Tree, network Network) *GeoPosition {
+	roots := tree.Roots
+	if network.IsV6() {
+		roots = tree.RootsV6
+	}
+	for n := tree.findClosestSupernet(network, roots); n != nil; n = n.Parent {
+		if n.GeoPosition != nil {
+			return n.GeoPosition
+		}
+	}
+	return nil
+}
+
+func checkFanOut(t *testing.T, tree *Tree, parent *Node, nodes []*Node) {
+	if len(nodes) > tree.Precision {
+		t.Fatalf("%v children exceed precision %v", len(nodes), tree.Precision)
+	}
+	for i, n := range nodes {
+		if n.Parent != parent {
+			t.Fatalf("%v has the wrong parent", n.Network)
+		}
+		if i > 0 && !nodes[i-1].Network.Before(n.Network) {
+			t.Fatalf("%v is not sorted after %v", n.Network, nodes[i-1].Network)
+		}
+		checkFanOut(t, tree, n, n.Children)
+	}
+}
+
+func TestBulkBuildMatchesInsert(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	seen := map[Network]bool{}
+	var networks []Network
+	for len(networks) < 3000 {
+		network := randomNetwork(r, 8, 28)
+		if !seen[network] {
+			seen[network] = true
+			networks = append(networks, network)
+		}
+	}
+	sort.Slice(networks, func(i, j int) bool { return networks[i].Before(networks[j]) })
+	positions := make([]*GeoPosition, len(networks))
+	inserted := NewTree(8)
+	for i, network := range networks {
+		positions[i] = &GeoPosition{Latitude: float64(i)}
+		inserted.insert(positions[i], network)
+	}
+	built := NewTree(8)
+	if err := built.BulkBuild(sliceIterator(networks, positions)); err != nil {
+		t.Fatal(err)
+	}
+	checkFanOut(t, built, nil, built.Roots)
+	for i := 0; i < 10000; i++ {
+		network := randomNetwork(r, 8, 32)
+		if populatedSupernet(built, network) != populatedSupernet(inserted, network) {
+			t.Fatalf("%v resolved differently after a bulk build", network)
+		}
+	}
+}
+
+func TestBulkBuildRejectsUnsortedInput(t *testing.T) {
+	networks := []Network{mustParseNetwork("10.1.0.0/16"), mustParseNetwork("10.0.0.0/16")}
+	if err := NewTree(8).BulkBuild(sliceIterator(networks, make([]*GeoPosition, 2))); err == nil {
+		t.Error("unsorted input was accepted")
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"container/list"
+	"math/bits"
+	"sync"
+	"sync/atomic"
+)
+
+const cacheShards = 16
+
+// lookupCache is a sharded LRU of lookup results keyed by address. Purging bumps the generation so
+// that a lookup which began before the tree changed cannot store its stale result afterwards.
+type lookupCache struct {
+	shards     []cacheShard
+	shift      uint // the top bits of the hash of a key select its shard
+	capacity   int
+	generation uint64
+	hits       uint64
+	misses     uint64
+}
+
+type cacheShard struct {
+	mtx      sync.Mutex
+	entries  map[lookupKey]*list.Element
+	order    *list.List // most recently used at the front
+	capacity int
+}
+
+type lookupKey struct {
+	host    Network
+	layered bool // LookupLayered rather than Lookup
+}
+
+type lookupResult struct {
+	node      *Node
+	precision PrecisionLevel
+}
+
+type cacheEntry struct {
+	key    lookupKey
+	result lookupResult
+}
+
+// CacheStats describes the lookup cache enabled by EnableCache
+type CacheStats struct {
+	Capacity int    `json:"capacity"`
+	Entries  int    `json:"entries"`
+	Hits     uint64 `json:"hits"`
+	Misses   uint64 `json:"misses"`
+}
+
+// newLookupCache splits the capacity exactly across the shards. Small caches get fewer shards so
+// that none of them is left without room.
+func newLookupCache(capacity int) *lookupCache {
+	count := cacheShards
+	for count > 1 && count > capacity {
+		count /= 2
+	}
+	cache := &lookupCache{shards: make([]cacheShard, count), shift: 64 - uint(bits.TrailingZeros(uint(count))), capacity: capacity}
+	for i := range cache.shards {
+		cache.shards[i].entries = map[lookupKey]*list.Element{}
+		cache.shards[i].order = list.New()
+		cache.shards[i].capacity = capacity / count
+		if i < capacity%count {
+			cache.shards[i].capacity++
+		}
+	}
+	return cache
+}
+
+func (cache *lookupCache) shard(key lookupKey) *cacheShard {
+	h := (key.host.hi ^ key.host.lo*0x9e3779b97f4a7c15) * 0xbf58476d1ce4e5b9
+	return &cache.shards[h>>cache.shift]
+}
+
+// get returns the cached result along with the generation that a result for a miss must be stored with
+func (cache *lookupCache) get(key lookupKey) (lookupResult, uint64, bool) {
+	generation := atomic.LoadUint64(&cache.generation)
+	shard := cache.shard(key)
+	shard.mtx.Lock()
+	defer shard.mtx.Unlock()
+	if element, found := shard.entries[key]; found {
+		shard.order.MoveToFront(element)
+		atomic.AddUint64(&cache.hits, 1)
+		return element.Value.(*cacheEntry).result, generation, true
+	}
+	atomic.AddUint64(&cache.misses, 1)
+	return lookupResult{}, generation, false
+}
+
+func (cache *lookupCache) put(key lookupKey, generation uint64, result lookupResult) {
+	shard := cache.shard(key)
+	shard.mtx.Lock()
+	defer shard.mtx.Unlock()
+	if atomic.LoadUint64(&cache.generation) != generation {
+		return
+	}
+	if element, found := shard.entries[key]; found {
+		element.Value.(*cacheEntry).result = result
+		shard.order.MoveToFront(element)
+		return
+	}
+	shard.entries[key] = shard.order.PushFront(&cacheEntry{key, result})
+	if shard.order.Len() > shard.capacity {
+		oldest := shard.order.Back()
+		shard.order.Remove(oldest)
+		delete(shard.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+func (cache *lookupCache) purge() {
+	atomic.AddUint64(&cache.generation, 1)
+	for i := range cache.shards {
+		shard := &cache.shards[i]
+		shard.mtx.Lock()
+		shard.entries = map[lookupKey]*list.Element{}
+		shard.order.Init()
+		shard.mtx.Unlock()
+	}
+}
+
+// EnableCache puts an LRU cache of the given number of addresses in front of Lookup and of
+// LookupLayered calls that exclude no statuses. A capacity of zero disables the cache.
+// The cache is emptied whenever the tree, its overrides or its special-purpose ranges change.
+func (tree *Tree) EnableCache(capacity int) {
+	if capacity <= 0 {
+		tree.cache.Store(nil)
+		return
+	}
+	tree.cache.Store(newLookupCache(capacity))
+}
+
+// CacheStats reports the hits and misses of the cache and whether it is enabled
+func (tree *Tree) CacheStats() (CacheStats, bool) {
+	cache := tree.lookupCache()
+	if cache == nil {
+		return CacheStats{}, false
+	}
+	stats := CacheStats{
+		Capacity: cache.capacity,
+		Hits:     atomic.LoadUint64(&cache.hits),
+		Misses:   atomic.LoadUint64(&cache.misses),
+	}
+	for i := range cache.shards {
+		cache.shards[i].mtx.Lock()
+		stats.Entries += cache.shards[i].order.Len()
+		cache.shards[i].mtx.Unlock()
+	}
+	return stats, true
+}
+
+func (tree *Tree) lookupCache() *lookupCache {
+	if tree.cache == nil {
+		return nil
+	}
+	return tree.cache.Load()
+}
+
+func (tree *Tree) purgeCache() {
+	if cache := tree.lookupCache(); cache != nil {
+		cache.purge()
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestLookupCacheEviction(t *testing.T) {
+	cache := newLookupCache(2 * cacheShards)
+	var keys []lookupKey
+	for i := uint32(0); len(keys) < 3; i++ {
+		ip := make(net.IP, net.IPv4len)
+		binary.BigEndian.PutUint32(ip, i)
+		host, _ := NetworkFromIP(ip)
+		if key := (lookupKey{host: host}); cache.shard(key) == &cache.shards[0] {
+			keys = append(keys, key)
+		}
+	}
+	for i, key := range keys[:2] {
+		_, generation, _ := cache.get(key)
+		cache.put(key, generation, lookupResult{precision: PrecisionLevel(i)})
+	}
+	if _, _, found := cache.get(keys[0]); !found {
+		t.Fatal("a cached result was not found")
+	}
+	_, generation, _ := cache.get(keys[2])
+	cache.put(keys[2], generation, lookupResult{})
+	if _, _, found := cache.get(keys[1]); found {
+		t.Error("the least recently used result should have been evicted")
+	}
+	if _, _, found := cache.get(keys[0]); !found {
+		t.Error("a recently used result was evicted")
+	}
+
+	_, generation, _ = cache.get(keys[1])
+	cache.purge()
+	cache.put(keys[1], generation, lookupResult{})
+	if _, _, found := cache.get(keys[1]); found {
+		t.Error("a result looked up before a purge should not be stored after it")
+	}
+
+	for i := uint32(0); i < 1000; i++ {
+		ip := make(net.IP, net.IPv4len)
+		binary.BigEndian.PutUint32(ip, i*7919)
+		host, _ := NetworkFromIP(ip)
+		_, generation, _ := cache.get(lookupKey{host: host})
+		cache.put(lookupKey{host: host}, generation, lookupResult{})
+	}
+	entries := 0
+	for i := range cache.shards {
+		entries += cache.shards[i].order.Len()
+	}
+	if entries > cache.capacity {
+		t.Errorf("%v entries exceed the capacity of %v", entries, cache.capacity)
+	}
+}
+
+func TestLookupCacheCapacity(t *testing.T) {
+	for _, capacity := range []int{1, 2, 3, 5, 15, 16, 17, 100, 1000} {
+		cache := newLookupCache(capacity)
+		for i := uint32(0); i < 5000; i++ {
+			ip := make(net.IP, net.IPv4len)
+			binary.BigEndian.PutUint32(ip, i*2654435761)
+			host, _ := NetworkFromIP(ip)
+			_, generation, _ := cache.get(lookupKey{host: host})
+			cache.put(lookupKey{host: host}, generation, lookupResult{})
+		}
+		entries := 0
+		for i := range cache.shards {
+			entries += cache.shards[i].order.Len()
+		}
+		if entries != capacity {
+			t.Errorf("a cache of %v addresses holds %v", capacity, entries)
+		}
+	}
+}
+
+func TestTreeCache(t *testing.T) {
+	tree := buildEnrichTree(t)
+	if _, enabled := tree.CacheStats(); enabled {
+		t.Fatal("the cache should be disabled by default")
+	}
+	tree.EnableCache(1024)
+	address := net.ParseIP("45.0.1.1")
+	first, second := tree.Lookup(address), tree.Lookup(address)
+	if first == nil || first != second {
+		t.Fatalf("cached lookup returned %v instead of %v", second, first)
+	}
+	n, precision := tree.LookupLayered(net.ParseIP("41.0.0.1"))
+	if m, cachedPrecision := tree.LookupLayered(net.ParseIP("41.0.0.1")); m != n || cachedPrecision != precision {
+		t.Errorf("cached layered lookup returned %v with %v", m, cachedPrecision)
+	}
+	tree.LookupLayered(net.ParseIP("41.0.0.1"), StatusReserved)
+	if stats, _ := tree.CacheStats(); stats.Hits != 2 || stats.Misses != 2 || stats.Entries != 2 {
+		t.Errorf("unexpected cache stats: %+v", stats)
+	}
+
+	tree.insert(&GeoPosition{Latitude: 1, Location: &GeoLocation{CountryISO: "BE"}}, mustParseNetwork("45.0.1.0/24"))
+	if n := tree.Lookup(address); n.Network != mustParseNetwork("45.0.1.0/24") {
+		t.Errorf("modifying the tree did not invalidate the cache: %v", n.Network)
+	}
+	tree.SetOverrides([]*Override{{Network: mustParseNetwork("41.0.0.0/24"),
+		GeoPosition: &GeoPosition{Location: &GeoLocation{CountryISO: "KE"}, Source: SourceOverride}}})
+	if n, _ := tree.LookupLayered(net.ParseIP("41.0.0.1")); n.GeoPosition.Source != SourceOverride {
+		t.Error("swapping the overrides did not invalidate the cache")
+	}
+	tree.AddSpecialPurpose(mustParseNetwork("45.0.1.0/25"), "lab", ClassPrivate, nil)
+	if n, precision := tree.LookupLayered(address); n != nil || precision != PrecisionNone {
+		t.Error("adding a special-purpose range did not invalidate the cache")
+	}
+
+	recorder := httptest.NewRecorder()
+	newServeMux(tree).ServeHTTP(recorder, httptest.NewRequest("GET", "/status", nil))
+	var status struct {
+		Cache *CacheStats `json:"cache"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	if status.Cache == nil || status.Cache.Capacity != 1024 || status.Cache.Misses == 0 {
+		t.Errorf("unexpected /status response: %v", recorder.Body.String())
+	}
+
+	tree.EnableCache(0)
+	if _, enabled := tree.CacheStats(); enabled {
+		t.Error("the cache should have been disabled")
+	}
+}
+
+func TestTreeCacheConcurrency(t *testing.T) {
+	tree := buildEnrichTree(t)
+	tree.EnableCache(64)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 2000; j++ {
+				ip := net.IPv4(45, 0, byte(j%256), byte(i))
+				if n := tree.Lookup(ip); n == nil {
+					t.Errorf("%v was not found", ip)
+					return
+				}
+				tree.LookupLayered(ip)
+				if j%500 == 0 {
+					tree.SetOverrides(nil)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if stats, _ := tree.CacheStats(); stats.Entries > 64 || stats.Hits+stats.Misses != 32000 {
+		t.Errorf("unexpected cache stats: %+v", stats)
+	}
+}
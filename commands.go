@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bufio"
+	"encoding/gob"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+)
+
+// treeFlag registers the flag that lets a command read a tree saved by build instead of ingesting
+func treeFlag(flags *flag.FlagSet) *string {
+	return flags.String("tree", "", "read a tree saved by build instead of ingesting the input data")
+}
+
+// loadTree reads a tree saved by build, or builds one from the input data when filename is empty
+func loadTree(filename string) *Tree {
+	if filename == "" {
+		return buildTree()
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		fatalf("unable to load tree because: %v", err)
+	}
+	defer f.Close()
+	tree := &Tree{}
+	if err := gob.NewDecoder(bufio.NewReader(f)).Decode(tree); err != nil {
+		fatalf("unable to load tree from '%v' because: %v", filename, err)
+	}
+	return tree
+}
+
+// saveTree writes the tree in the format read by loadTree
+func saveTree(tree *Tree, filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	buffered := bufio.NewWriter(f)
+	if err := gob.NewEncoder(buffered).Encode(tree); err != nil {
+		f.Close()
+		return err
+	}
+	if err := buffered.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func buildCommand(args []string) {
+	flags := flag.NewFlagSet("build", flag.ContinueOnError)
+	output := flags.String("o", "tree.bin", "file to save the tree to")
+	parseFlags(flags, args)
+	tree := buildTree()
+	if err := saveTree(tree, *output); err != nil {
+		fatalf("unable to save tree because: %v", err)
+	}
+	log.Printf("saved %v networks to %v", tree.Size, *output)
+}
+
+func lookupCommand(args []string) {
+	flags := flag.NewFlagSet("lookup", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print one JSON object per address")
+	exclude := flags.String("exclude", "", "comma separated allocation statuses to ignore in registry data")
+	normalize := flags.String("normalize", "", "comma separated transformations to apply to IPv6 addresses")
+	overrides := flags.String("overrides", "", "csv, json or yaml file of overrides")
+	treeFile := treeFlag(flags)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: networktree lookup [flags] address...")
+		flags.PrintDefaults()
+	}
+	parseFlags(flags, args)
+	statuses, err := parseStatuses(*exclude)
+	if err != nil {
+		log.Print(err)
+		exit(exitUsage)
+	}
+	enabled, err := parseTransformations(*normalize)
+	if err != nil {
+		log.Print(err)
+		exit(exitUsage)
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		exit(exitUsage)
+	}
+	for _, arg := range flags.Args() {
+		if address, _ := ParseAddress(arg, enabled...); address == nil {
+			log.Printf("'%v' is not a valid address", arg)
+			exit(exitUsage)
+		}
+	}
+	tree := loadTree(*treeFile)
+	if *overrides != "" {
+		if err := tree.ReloadOverrides(*overrides); err != nil {
+			fatalf("unable to load overrides because: %v", err)
+		}
+	}
+	w := bufio.NewWriter(os.Stdout)
+	encoder := json.NewEncoder(w)
+	code := 0
+	for _, arg := range flags.Args() {
+		address, transformation := ParseAddress(arg, enabled...)
+		result, found := tree.lookupJSON(address, transformation, statuses)
+		if !found {
+			code = exitNotFound
+		}
+		if *asJSON {
+			encoder.Encode(result)
+		} else {
+			result.writeText(w, arg)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		fatalf("unable to print results because: %v", err)
+	}
+	exit(code)
+}
+
+// writeText prints the lookup as a single tab separated line of
+// address, network, precision, source, country, city, latitude and longitude
+func (result lookupJSON) writeText(w *bufio.Writer, arg string) {
+	if result.nodeJSON == nil {
+		note := "not found"
+		if result.Special != nil {
+			note = result.Special.Class.String() + " " + result.Special.Network.String() + " " + strconv.Quote(result.Special.Name)
+		}
+		fmt.Fprintf(w, "%v\t%v\n", arg, note)
+		return
+	}
+	fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n", arg, result.Network, result.Precision, result.Source,
+		result.CountryISO, result.CityName, result.Latitude, result.Longitude)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"path"
+	"testing"
+)
+
+func TestSaveTree(t *testing.T) {
+	tree := buildFixtureTree(t)
+	filename := path.Join(t.TempDir(), "tree.bin")
+	if err := saveTree(tree, filename); err != nil {
+		t.Fatal(err)
+	}
+	loaded := loadTree(filename)
+	if loaded.Size != tree.Size || len(loaded.Metadata.Sources) != len(tree.Metadata.Sources) {
+		t.Errorf("loaded tree has %v nodes and %v sources", loaded.Size, len(loaded.Metadata.Sources))
+	}
+	if n, precision := loaded.LookupLayered(net.ParseIP("41.0.0.1")); n == nil || precision != PrecisionCountry {
+		t.Error("registry data was not loaded")
+	}
+}
+
+func TestLookupText(t *testing.T) {
+	tree := buildFixtureTree(t)
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	for _, arg := range []string{"41.0.0.1", "10.0.0.1", "8.8.8.8"} {
+		result, _ := tree.lookupJSON(net.ParseIP(arg), TransformNone, nil)
+		result.writeText(w, arg)
+	}
+	w.Flush()
+	expected := "41.0.0.1\t41.0.0.0/16\tcountry\tafrinic\tZA\t\t-29.000000\t24.000000\n" +
+		"10.0.0.1\tprivate 10.0.0.0/8 \"Private-Use\"\n" +
+		"8.8.8.8\tnot found\n"
+	if buf.String() != expected {
+		t.Errorf("unexpected output:\n%v", buf.String())
+	}
+}
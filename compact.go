@@ -0,0 +1,68 @@
+package main
+
+// Compact merges adjacent siblings that share a GeoPosition into their covering supernet
+// and removes children that only repeat the GeoPosition of their parent
+func (tree *Tree) Compact() {
+	tree.Roots = tree.compactNodes(nil, tree.Roots)
+	tree.RootsV6 = tree.compactNodes(nil, tree.RootsV6)
+	tree.modified()
+}
+
+func (tree *Tree) compactNodes(parent *Node, nodes []*Node) []*Node {
+	var result []*Node
+	for _, n := range nodes {
+		n.Children = tree.compactNodes(n, n.Children)
+		result = tree.appendCompacted(parent, result, n)
+	}
+	return result
+}
+
+func (tree *Tree) appendCompacted(parent *Node, nodes []*Node, n *Node) []*Node {
+	if parent != nil && samePosition(n.GeoPosition, parent.GeoPosition) {
+		tree.Size--
+		for _, child := range n.Children {
+			child.Parent = parent
+			nodes = tree.appendCompacted(parent, nodes, child)
+		}
+		return nodes
+	}
+	if len(nodes) > 0 {
+		prev := nodes[len(nodes)-1]
+		if supernet, ok := tree.mergedNetwork(parent, prev, n); ok {
+			prev.Network = supernet
+			for _, child := range n.Children {
+				child.Parent = prev
+			}
+			prev.Children = append(prev.Children, n.Children...)
+			tree.Size--
+			return tree.appendCompacted(parent, nodes[:len(nodes)-1], prev)
+		}
+	}
+	return append(nodes, n)
+}
+
+// mergedNetwork returns the supernet of two sibling halves that resolve to the same position
+func (tree *Tree) mergedNetwork(parent, lower, upper *Node) (Network, bool) {
+	if !samePosition(lower.GeoPosition, upper.GeoPosition) {
+		return Network{}, false
+	}
+	supernet, ok := lower.Network.join(upper.Network)
+	if !ok || (parent != nil && supernet == parent.Network) {
+		return Network{}, false
+	}
+	return supernet, true
+}
+
+func samePosition(a, b *GeoPosition) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if a.Latitude != b.Latitude || a.Longitude != b.Longitude || a.AccuracyRadius != b.AccuracyRadius ||
+		a.Source != b.Source || a.Allocation != b.Allocation {
+		return false
+	}
+	if a.Location == nil || b.Location == nil {
+		return a.Location == b.Location
+	}
+	return *a.Location == *b.Location
+}
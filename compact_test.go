@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"testing"
+)
+
+func randomCompactTree(r *rand.Rand, positions []*GeoPosition) *Tree {
+	tree := NewTree(4)
+	for i := 0; i < 500; i++ {
+		ones := 8 + r.Intn(17)
+		mask := net.CIDRMask(ones, 32)
+		ip := net.IPv4(10, byte(r.Intn(4)), byte(r.Intn(256)), 0).Mask(mask)
+		network, _ := NetworkFromIPNet(&net.IPNet{IP: ip, Mask: mask})
+		tree.insert(positions[r.Intn(len(positions))], network)
+	}
+	return tree
+}
+
+func TestCompactKeepsLookups(t *testing.T) {
+	positions := []*GeoPosition{
+		{Latitude: 48.85, Longitude: 2.35, Location: &GeoLocation{CountryISO: "FR"}},
+		{Latitude: 51, Longitude: 9, Location: &GeoLocation{CountryISO: "DE"}},
+		{Latitude: -23.5, Longitude: -46.6, Location: &GeoLocation{CountryISO: "BR"}},
+	}
+	for seed := int64(1); seed <= 20; seed++ {
+		r := rand.New(rand.NewSource(seed))
+		tree := randomCompactTree(r, positions)
+		var addresses []net.IP
+		var prefixes []*net.IPNet
+		for i := 0; i < 2000; i++ {
+			addresses = append(addresses, net.IPv4(10, byte(r.Intn(5)), byte(r.Intn(256)), byte(r.Intn(256))))
+			// prefixes finer than every inserted network never straddle two merged siblings
+			_, prefix, _ := net.ParseCIDR(fmt.Sprintf("10.%v.%v.%v/28", r.Intn(5), r.Intn(256), 16*r.Intn(16)))
+			prefixes = append(prefixes, prefix)
+		}
+		position := func(n *Node) *GeoPosition {
+			if n == nil {
+				return nil
+			}
+			return n.GeoPosition
+		}
+		var lookups, coverings []*GeoPosition
+		for i := range addresses {
+			lookups = append(lookups, position(tree.Lookup(addresses[i])))
+			coverings = append(coverings, position(tree.Covering(prefixes[i])))
+		}
+		size := tree.Size
+		tree.Compact()
+		if tree.Size >= size {
+			t.Errorf("seed %v: compacting did not remove any of the %v nodes", seed, size)
+		}
+		for i := range addresses {
+			if p := position(tree.Lookup(addresses[i])); !samePosition(p, lookups[i]) {
+				t.Fatalf("seed %v: Lookup(%v) changed from %v to %v", seed, addresses[i], lookups[i], p)
+			}
+			if p := position(tree.Covering(prefixes[i])); !samePosition(p, coverings[i]) {
+				t.Fatalf("seed %v: Covering(%v) changed from %v to %v", seed, prefixes[i], coverings[i], p)
+			}
+		}
+	}
+}
+
+func TestCompactKeepsAccuracy(t *testing.T) {
+	tree := NewTree(16)
+	tree.insert(&GeoPosition{Latitude: 48.85, Longitude: 2.35, AccuracyRadius: 1000, Source: SourceGeoLite}, mustParseNetwork("10.0.0.0/24"))
+	tree.insert(&GeoPosition{Latitude: 48.85, Longitude: 2.35, AccuracyRadius: 5, Source: SourceGeoLite}, mustParseNetwork("10.0.1.0/24"))
+	tree.insert(&GeoPosition{Latitude: 48.85, Longitude: 2.35, AccuracyRadius: 5, Source: SourceARIN}, mustParseNetwork("10.0.2.0/24"))
+	tree.insert(&GeoPosition{Latitude: 48.85, Longitude: 2.35, AccuracyRadius: 5, Source: SourceGeoLite}, mustParseNetwork("10.0.3.0/24"))
+	tree.Compact()
+	for address, expected := range map[string]Network{
+		"10.0.0.1": mustParseNetwork("10.0.0.0/24"),
+		"10.0.1.1": mustParseNetwork("10.0.1.0/24"),
+		"10.0.2.1": mustParseNetwork("10.0.2.0/24"),
+		"10.0.3.1": mustParseNetwork("10.0.3.0/24"),
+	} {
+		if n := tree.Lookup(net.ParseIP(address)); n == nil || n.Network != expected {
+			t.Errorf("%v resolved to %v after siblings with different radii or sources were merged", address, n)
+		}
+	}
+	if n := tree.Lookup(net.ParseIP("10.0.1.1")); n == nil || n.GeoPosition.AccuracyRadius != 5 {
+		t.Error("the accuracy radius changed to", n.GeoPosition.AccuracyRadius)
+	}
+}
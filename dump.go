@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"strconv"
+)
+
+func dumpCommand(args []string) {
+	flags := flag.NewFlagSet("dump", flag.ContinueOnError)
+	format := flags.String("format", "json", "json, csv or mmdb")
+	output := flags.String("o", "", "write to a file instead of stdout")
+	treeFile := treeFlag(flags)
+	parseFlags(flags, args)
+	var write func(w io.Writer, tree *Tree) error
+	switch *format {
+	case "json":
+		write = func(w io.Writer, tree *Tree) error {
+			_, err := io.WriteString(w, tree.JSON()+"\n")
+			return err
+		}
+	case "csv":
+		write = writeCSV
+	case "mmdb":
+		write = writeMMDB
+	default:
+		log.Printf("'%v' is not a supported format", *format)
+		exit(exitUsage)
+	}
+	tree := loadTree(*treeFile)
+	w := os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			fatalf("unable to dump tree because: %v", err)
+		}
+		defer f.Close()
+		w = f
+	}
+	buffered := bufio.NewWriter(w)
+	if err := write(buffered, tree); err != nil {
+		fatalf("unable to dump tree because: %v", err)
+	}
+	if err := buffered.Flush(); err != nil {
+		fatalf("unable to dump tree because: %v", err)
+	}
+}
+
+// writeCSV writes every populated network with parents ahead of the more specific networks inside them
+func writeCSV(w io.Writer, tree *Tree) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"network", "latitude", "longitude", "accuracy_radius", "city_name", "subdivision_name",
+		"country_iso_code", "country_name", "is_in_european_union", "source"})
+	var walk func(nodes []*Node)
+	walk = func(nodes []*Node) {
+		for _, n := range nodes {
+			if n.GeoPosition != nil {
+				location := n.GeoPosition.Location
+				if location == nil {
+					location = &GeoLocation{}
+				}
+				writer.Write([]string{
+					n.Network.String(),
+					strconv.FormatFloat(n.GeoPosition.Latitude, 'f', -1, 64),
+					strconv.FormatFloat(n.GeoPosition.Longitude, 'f', -1, 64),
+					strconv.Itoa(int(n.GeoPosition.AccuracyRadius)),
+					location.CityName,
+					location.SubdivName,
+					location.CountryISO,
+					location.CountryName,
+					strconv.FormatBool(location.IsPartOfEU),
+					n.GeoPosition.Source.String(),
+				})
+			}
+			walk(n.Children)
+		}
+	}
+	walk(tree.Roots)
+	walk(tree.RootsV6)
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+)
+
+func TestWriteCSV(t *testing.T) {
+	tree := NewTree(16)
+	tree.insert(&GeoPosition{Latitude: 48.85, Longitude: 2.35, AccuracyRadius: 20, Source: SourceGeoLite,
+		Location: &GeoLocation{CityName: "Paris", CountryISO: "FR", CountryName: "France", IsPartOfEU: true}},
+		mustParseNetwork("45.0.0.0/8"))
+	tree.insert(&GeoPosition{Latitude: -12.5, Longitude: 18.5, Source: SourceAFRINIC},
+		mustParseNetwork("45.1.0.0/16"), mustParseNetwork("2c0f:f000::/32"))
+	var buf bytes.Buffer
+	if err := writeCSV(&buf, tree); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := [][]string{
+		{"network", "latitude", "longitude", "accuracy_radius", "city_name", "subdivision_name",
+			"country_iso_code", "country_name", "is_in_european_union", "source"},
+		{"45.0.0.0/8", "48.85", "2.35", "20", "Paris", "", "FR", "France", "true", "geolite2-city"},
+		{"45.1.0.0/16", "-12.5", "18.5", "0", "", "", "", "", "false", "afrinic"},
+		{"2c0f:f000::/32", "-12.5", "18.5", "0", "", "", "", "", "false", "afrinic"},
+	}
+	if len(rows) != len(expected) {
+		t.Fatalf("unexpected rows: %q", rows)
+	}
+	for i := range expected {
+		for j := range expected[i] {
+			if rows[i][j] != expected[i][j] {
+				t.Errorf("row %v column %v was %q instead of %q", i, j, rows[i][j], expected[i][j])
+			}
+		}
+	}
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+const enrichBatchSize = 256
+
+// enricher appends the position of the address found on every line of a log
+type enricher struct {
+	tree     *Tree
+	extract  func(line string) string
+	format   string // tsv, csv or json
+	enabled  []Transformation
+	found    uint64
+	lines    uint64
+	unparsed uint64
+}
+
+type enrichBatch struct {
+	lines []string
+	done  chan []byte
+}
+
+func enrichCommand(args []string) {
+	flags := flag.NewFlagSet("enrich", flag.ContinueOnError)
+	field := flags.Int("field", 1, "1-based index of the field that holds the address")
+	delimiter := flags.String("delimiter", "", "separator between fields (default whitespace)")
+	pattern := flags.String("regex", "", "regular expression whose first group, or whole match, is the address")
+	jsonKey := flags.String("json-key", "", "dot separated key of the address in JSON lines")
+	format := flags.String("format", "tsv", "tsv, csv or json")
+	workers := flags.Int("workers", runtime.NumCPU(), "number of lines looked up concurrently")
+	normalize := flags.String("normalize", "", "comma separated transformations to apply to IPv6 addresses")
+	overrides := flags.String("overrides", "", "csv, json or yaml file of overrides")
+	cacheSize := flags.Int("cache", 0, "number of addresses whose lookups are cached, 0 disables the cache")
+	treeFile := treeFlag(flags)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: networktree enrich [flags] [file...]")
+		flags.PrintDefaults()
+	}
+	parseFlags(flags, args)
+	extract, err := newExtractor(*field, *delimiter, *pattern, *jsonKey)
+	if err != nil {
+		log.Print(err)
+		exit(exitUsage)
+	}
+	enabled, err := parseTransformations(*normalize)
+	if err != nil {
+		log.Print(err)
+		exit(exitUsage)
+	}
+	if *format != "tsv" && *format != "csv" && *format != "json" {
+		log.Printf("'%v' is not a supported format", *format)
+		exit(exitUsage)
+	}
+	if *workers < 1 {
+		log.Printf("at least one worker is required")
+		exit(exitUsage)
+	}
+	var inputs []io.Reader
+	for _, filename := range flags.Args() {
+		if filename == "-" {
+			inputs = append(inputs, os.Stdin)
+			continue
+		}
+		f, err := os.Open(filename)
+		if err != nil {
+			fatalf("unable to enrich because: %v", err)
+		}
+		defer f.Close()
+		inputs = append(inputs, f)
+	}
+	if len(inputs) == 0 {
+		inputs = append(inputs, os.Stdin)
+	}
+	tree := loadTree(*treeFile)
+	tree.EnableCache(*cacheSize)
+	if *overrides != "" {
+		if err := tree.ReloadOverrides(*overrides); err != nil {
+			fatalf("unable to load overrides because: %v", err)
+		}
+	}
+	e := &enricher{tree: tree, extract: extract, format: *format, enabled: enabled}
+	w := bufio.NewWriterSize(os.Stdout, 1<<16)
+	if err := e.run(inputs, w, *workers); err != nil {
+		fatalf("unable to enrich because: %v", err)
+	}
+	if err := w.Flush(); err != nil {
+		fatalf("unable to enrich because: %v", err)
+	}
+	log.Printf("found %v of %v lines, %v without an address", e.found, e.lines, e.unparsed)
+	if stats, enabled := tree.CacheStats(); enabled {
+		log.Printf("cache hits: %v  misses: %v", stats.Hits, stats.Misses)
+	}
+}
+
+// newExtractor returns a function that pulls the address out of a line using whichever of the
+// regular expression, JSON key or field index was given
+func newExtractor(field int, delimiter, pattern, jsonKey string) (func(line string) string, error) {
+	if pattern != "" && jsonKey != "" {
+		return nil, errors.New("only one of -regex and -json-key can be used")
+	}
+	if pattern != "" {
+		expression, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("'%v' is not a valid regular expression", pattern)
+		}
+		return func(line string) string {
+			match := expression.FindStringSubmatch(line)
+			if len(match) > 1 {
+				return match[1]
+			} else if len(match) == 1 {
+				return match[0]
+			}
+			return ""
+		}, nil
+	}
+	if jsonKey != "" {
+		keys := strings.Split(jsonKey, ".")
+		return func(line string) string {
+			var value interface{}
+			if json.Unmarshal([]byte(line), &value) != nil {
+				return ""
+			}
+			for _, key := range keys {
+				object, ok := value.(map[string]interface{})
+				if !ok {
+					return ""
+				}
+				value = object[key]
+			}
+			s, _ := value.(string)
+			return s
+		}, nil
+	}
+	if field < 1 {
+		return nil, fmt.Errorf("field %v is not valid since fields are numbered from 1", field)
+	}
+	return func(line string) string {
+		var fields []string
+		if delimiter == "" {
+			fields = strings.Fields(line)
+		} else {
+			fields = strings.Split(line, delimiter)
+		}
+		if field > len(fields) {
+			return ""
+		}
+		return fields[field-1]
+	}, nil
+}
+
+// cleanAddress removes the quotes, brackets and port that often surround an address in logs
+func cleanAddress(s string) string {
+	s = strings.Trim(strings.TrimSpace(s), `"'`)
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		return host
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+}
+
+// run enriches every line of the inputs in a pool of workers and writes them in their original order
+func (e *enricher) run(inputs []io.Reader, w io.Writer, workers int) error {
+	batches := make(chan *enrichBatch, workers)
+	ordered := make(chan *enrichBatch, 2*workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for batch := range batches {
+				var buf bytes.Buffer
+				for _, line := range batch.lines {
+					e.enrich(&buf, line)
+				}
+				batch.done <- buf.Bytes()
+			}
+		}()
+	}
+	var readErr error
+	go func() {
+		defer close(ordered)
+		defer close(batches)
+		batch := &enrichBatch{done: make(chan []byte, 1)}
+		for _, input := range inputs {
+			reader := bufio.NewReaderSize(input, 1<<16)
+			for {
+				line, err := reader.ReadString('\n')
+				if line != "" {
+					batch.lines = append(batch.lines, strings.TrimRight(line, "\r\n"))
+				}
+				if len(batch.lines) == enrichBatchSize {
+					ordered <- batch
+					batches <- batch
+					batch = &enrichBatch{done: make(chan []byte, 1)}
+				}
+				if err == io.EOF {
+					break
+				} else if err != nil {
+					readErr = err
+					return
+				}
+			}
+		}
+		if len(batch.lines) > 0 {
+			ordered <- batch
+			batches <- batch
+		}
+	}()
+	var writeErr error
+	for batch := range ordered {
+		output := <-batch.done
+		if writeErr == nil {
+			_, writeErr = w.Write(output) // keep draining so that the reader and workers can finish
+		}
+	}
+	if readErr != nil {
+		return readErr
+	}
+	return writeErr
+}
+
+// enrich appends the lat, lon, city, country and asn fields to the line, nesting them under a
+// networktree key for JSON. Lines without an address are kept with empty fields so that the
+// output lines up with the input.
+func (e *enricher) enrich(buf *bytes.Buffer, line string) {
+	atomic.AddUint64(&e.lines, 1)
+	var geoPosition *GeoPosition
+	location := &GeoLocation{}
+	asns := []string{}
+	address, _ := ParseAddress(cleanAddress(e.extract(line)), e.enabled...)
+	if address == nil {
+		atomic.AddUint64(&e.unparsed, 1)
+	} else {
+		if n, _ := e.tree.LookupLayered(address); n != nil {
+			atomic.AddUint64(&e.found, 1)
+			geoPosition = n.GeoPosition
+			if geoPosition.Location != nil {
+				location = geoPosition.Location
+			}
+		}
+		for _, record := range e.tree.LookupASNs(address) {
+			if record.First == record.Last {
+				asns = append(asns, strconv.FormatUint(uint64(record.First), 10))
+			} else {
+				asns = append(asns, fmt.Sprintf("%v-%v", record.First, record.Last))
+			}
+		}
+	}
+
+	if e.format == "json" {
+		fields := struct {
+			Latitude  *float64 `json:"lat"`
+			Longitude *float64 `json:"lon"`
+			City      string   `json:"city"`
+			Country   string   `json:"country"`
+			ASN       []string `json:"asn"`
+		}{City: location.CityName, Country: location.CountryISO, ASN: asns}
+		if geoPosition != nil {
+			fields.Latitude, fields.Longitude = &geoPosition.Latitude, &geoPosition.Longitude
+		}
+		b, _ := json.Marshal(fields)
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "{") && json.Valid([]byte(trimmed)) {
+			setJSONKey(buf, trimmed, "networktree", b)
+		} else {
+			quoted, _ := json.Marshal(line)
+			buf.WriteString(`{"line":`)
+			buf.Write(quoted)
+			buf.WriteString(`,"networktree":`)
+			buf.Write(b)
+			buf.WriteByte('}')
+		}
+		buf.WriteByte('\n')
+		return
+	}
+
+	var latitude, longitude string
+	if geoPosition != nil {
+		latitude = strconv.FormatFloat(geoPosition.Latitude, 'f', -1, 64)
+		longitude = strconv.FormatFloat(geoPosition.Longitude, 'f', -1, 64)
+	}
+	values := []string{latitude, longitude, location.CityName, location.CountryISO, strings.Join(asns, " ")}
+	buf.WriteString(line)
+	if e.format == "csv" {
+		buf.WriteByte(',')
+		writer := csv.NewWriter(buf)
+		writer.Write(values)
+		writer.Flush()
+		return
+	}
+	for _, value := range values {
+		buf.WriteByte('\t')
+		buf.WriteString(strings.ReplaceAll(value, "\t", " "))
+	}
+	buf.WriteByte('\n')
+}
+
+// setJSONKey writes the valid JSON object with the value under the key, replacing any value the
+// object already held there. The other keys keep their order.
+func setJSONKey(buf *bytes.Buffer, object, key string, value []byte) {
+	decoder := json.NewDecoder(strings.NewReader(object))
+	decoder.Token()
+	buf.WriteByte('{')
+	for decoder.More() {
+		name, _ := decoder.Token()
+		var raw json.RawMessage
+		decoder.Decode(&raw)
+		if name == key {
+			continue
+		}
+		quoted, _ := json.Marshal(name)
+		buf.Write(quoted)
+		buf.WriteByte(':')
+		buf.Write(raw)
+		buf.WriteByte(',')
+	}
+	quoted, _ := json.Marshal(key)
+	buf.Write(quoted)
+	buf.WriteByte(':')
+	buf.Write(value)
+	buf.WriteByte('}')
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func buildEnrichTree(t *testing.T) *Tree {
+	writeGeoliteFixtures(t, []string{"45.0.0.0/16,1,,,0,0,,48.85,2.35,20"}, nil)
+	writeDelegatedFixtures(t, map[string]string{
+		afrinicPath: "2|afrinic|20190107|4|00000000|20190107|00000\n" +
+			"afrinic|*|asn|*|2|summary\n" +
+			"afrinic|*|ipv4|*|1|summary\n" +
+			"afrinic|*|ipv6|*|1|summary\n" +
+			"afrinic|ZA|asn|1228|1|19910301|allocated|F36B9F4B\n" +
+			"afrinic|ZA|asn|5536|4|19910301|allocated|F36B9F4B\n" +
+			"afrinic|ZA|ipv4|41.0.0.0|65536|20070409|allocated|F36B9F4B\n" +
+			"afrinic|ZA|ipv6|2c0f:f000::|32|20070410|allocated|F36B9F4B\n",
+	})
+	tree := NewTree(16)
+	ingestGeoliteData(tree)
+	ingestRIRData(tree)
+	tree.Compact()
+	return tree
+}
+
+func TestEnrich(t *testing.T) {
+	tree := buildEnrichTree(t)
+	for _, test := range []struct {
+		name      string
+		field     int
+		delimiter string
+		pattern   string
+		jsonKey   string
+		format    string
+		input     string
+		output    string
+	}{
+		{"whitespace", 1, "", "", "", "tsv",
+			"45.0.0.1 - - \"GET / HTTP/1.1\" 200\n",
+			"45.0.0.1 - - \"GET / HTTP/1.1\" 200\t48.85\t2.35\tParis\tFR\t\n"},
+		{"delimiter and port", 2, ",", "", "", "csv",
+			"1,\"41.0.0.1:443\",GET\n[2c0f:f000::1]:443,x\n",
+			"1,\"41.0.0.1:443\",GET,-29,24,,ZA,1228 5536-5539\n[2c0f:f000::1]:443,x,,,,,\n"},
+		{"regex", 0, "", `client=(\S+)`, "", "tsv",
+			"time=1 client=[2c0f:f000::1] path=/\ntime=2 path=/\n",
+			"time=1 client=[2c0f:f000::1] path=/\t-29\t24\t\tZA\t1228 5536-5539\ntime=2 path=/\t\t\t\t\t\n"},
+		{"json key", 0, "", "", "client.ip", "json",
+			"{\"time\":1,\"client\":{\"ip\":\"45.0.0.1\"}}\n{}\nnot json\n",
+			"{\"time\":1,\"client\":{\"ip\":\"45.0.0.1\"},\"networktree\":{\"lat\":48.85,\"lon\":2.35,\"city\":\"Paris\",\"country\":\"FR\",\"asn\":[]}}\n" +
+				"{\"networktree\":{\"lat\":null,\"lon\":null,\"city\":\"\",\"country\":\"\",\"asn\":[]}}\n" +
+				"{\"line\":\"not json\",\"networktree\":{\"lat\":null,\"lon\":null,\"city\":\"\",\"country\":\"\",\"asn\":[]}}\n"},
+		{"json with the enriched keys", 0, "", "", "ip", "json",
+			"{\"ip\":\"41.0.0.1\",\"country\":\"xx\",\"networktree\":{\"stale\":true},\"asn\" : 1}\n",
+			"{\"ip\":\"41.0.0.1\",\"country\":\"xx\",\"asn\":1,\"networktree\":{\"lat\":-29,\"lon\":24,\"city\":\"\",\"country\":\"ZA\",\"asn\":[\"1228\",\"5536-5539\"]}}\n"},
+	} {
+		extract, err := newExtractor(test.field, test.delimiter, test.pattern, test.jsonKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e := &enricher{tree: tree, extract: extract, format: test.format}
+		var buf bytes.Buffer
+		if err := e.run([]io.Reader{strings.NewReader(test.input)}, &buf, 2); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != test.output {
+			t.Errorf("%v produced\n%q\ninstead of\n%q", test.name, buf.String(), test.output)
+		}
+	}
+}
+
+func TestEnrichKeepsOrder(t *testing.T) {
+	tree := buildEnrichTree(t)
+	var input, expected strings.Builder
+	for i := 0; i < 10*enrichBatchSize+7; i++ {
+		if i%3 == 0 {
+			fmt.Fprintf(&input, "%v 45.0.%v.1\n", i, i%256)
+			fmt.Fprintf(&expected, "%v 45.0.%v.1,48.85,2.35,Paris,FR,\n", i, i%256)
+		} else {
+			fmt.Fprintf(&input, "%v 41.0.%v.1\n", i, i%256)
+			fmt.Fprintf(&expected, "%v 41.0.%v.1,-29,24,,ZA,1228 5536-5539\n", i, i%256)
+		}
+	}
+	extract, _ := newExtractor(2, "", "", "")
+	e := &enricher{tree: tree, extract: extract, format: "csv"}
+	var buf bytes.Buffer
+	half := input.Len() / 2
+	half += strings.IndexByte(input.String()[half:], '\n') + 1
+	inputs := []io.Reader{strings.NewReader(input.String()[:half]), strings.NewReader(input.String()[half:])}
+	if err := e.run(inputs, &buf, 8); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != expected.String() {
+		t.Error("enriched lines were not written in their original order")
+	}
+	if e.lines != 10*enrichBatchSize+7 || e.found != e.lines || e.unparsed != 0 {
+		t.Errorf("unexpected counts: %v lines, %v found, %v without an address", e.lines, e.found, e.unparsed)
+	}
+}
+
+func TestNewExtractor(t *testing.T) {
+	for _, test := range []struct {
+		field     int
+		delimiter string
+		pattern   string
+		jsonKey   string
+	}{
+		{0, "", "", ""},
+		{1, "", "(", ""},
+		{1, "", "ip=(\\S+)", "ip"},
+	} {
+		if _, err := newExtractor(test.field, test.delimiter, test.pattern, test.jsonKey); err == nil {
+			t.Errorf("%+v should have been rejected", test)
+		}
+	}
+	for input, expected := range map[string]string{
+		"\"10.0.0.1\"":      "10.0.0.1",
+		"10.0.0.1:8080":     "10.0.0.1",
+		"[2001:db8::1]:443": "2001:db8::1",
+		"[2001:db8::1]":     "2001:db8::1",
+		"2001:db8::1":       "2001:db8::1",
+	} {
+		if address := cleanAddress(input); address != expected {
+			t.Errorf("%v was cleaned to %v instead of %v", input, address, expected)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"time"
+)
+
+const earthRadiusKm = 6371.0
+
+// coarseAccuracyRadius is assumed in kilometers for positions that do not carry an accuracy radius
+const coarseAccuracyRadius = 1000
+
+// GeoDistance describes the great-circle path between the positions of two addresses
+type GeoDistance struct {
+	Kilometers float64
+	Bearing    float64 // initial bearing in degrees clockwise from north
+	Confidence float64 // share of the distance not explained by the accuracy radii of both positions
+}
+
+// Distance returns the great-circle distance and initial bearing between the positions of two addresses
+func (tree *Tree) Distance(addressA, addressB net.IP) (GeoDistance, error) {
+	nodeA, nodeB := tree.Lookup(addressA), tree.Lookup(addressB)
+	if nodeA == nil {
+		return GeoDistance{}, fmt.Errorf("no position found for %v", addressA)
+	}
+	if nodeB == nil {
+		return GeoDistance{}, fmt.Errorf("no position found for %v", addressB)
+	}
+	a, b := nodeA.GeoPosition, nodeB.GeoPosition
+	result := GeoDistance{
+		Kilometers: haversine(a.Latitude, a.Longitude, b.Latitude, b.Longitude),
+		Bearing:    initialBearing(a.Latitude, a.Longitude, b.Latitude, b.Longitude),
+	}
+	if result.Kilometers > 0 {
+		uncertainty := tree.accuracyRadius(addressA, nodeA) + tree.accuracyRadius(addressB, nodeB)
+		result.Confidence = math.Max(0, (result.Kilometers-uncertainty)/result.Kilometers)
+	}
+	return result, nil
+}
+
+// ImpossibleTravel reports whether getting from addressA at timeA to addressB at timeB would
+// require moving faster than maxKmh once the accuracy of both positions has been allowed for
+func (tree *Tree) ImpossibleTravel(addressA net.IP, timeA time.Time, addressB net.IP, timeB time.Time,
+	maxKmh float64) (bool, error) {
+	distance, err := tree.Distance(addressA, addressB)
+	if err != nil {
+		return false, err
+	}
+	minimumKm := distance.Kilometers * distance.Confidence
+	hours := math.Abs(timeB.Sub(timeA).Hours())
+	if hours == 0 {
+		return minimumKm > 0, nil
+	}
+	return minimumKm/hours > maxKmh, nil
+}
+
+// accuracyRadius widens the radius of a position that Lookup only reached by falling back from a
+// synthetic or unpopulated node to an ancestor, since the ancestor describes a wider network
+func (tree *Tree) accuracyRadius(address net.IP, n *Node) float64 {
+	radius := float64(n.GeoPosition.AccuracyRadius)
+	if radius == 0 || tree.findContaining(address) != n {
+		return math.Max(radius, coarseAccuracyRadius)
+	}
+	return radius
+}
+
+// haversine returns the great-circle distance in kilometers between two points
+func haversine(latitudeA, longitudeA, latitudeB, longitudeB float64) float64 {
+	phiA, phiB := latitudeA*math.Pi/180, latitudeB*math.Pi/180
+	deltaPhi := phiB - phiA
+	deltaLambda := (longitudeB - longitudeA) * math.Pi / 180
+	a := math.Sin(deltaPhi/2)*math.Sin(deltaPhi/2) +
+		math.Cos(phiA)*math.Cos(phiB)*math.Sin(deltaLambda/2)*math.Sin(deltaLambda/2)
+	return 2 * earthRadiusKm * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
+
+// initialBearing returns the compass bearing in degrees to set off on from the first point
+func initialBearing(latitudeA, longitudeA, latitudeB, longitudeB float64) float64 {
+	phiA, phiB := latitudeA*math.Pi/180, latitudeB*math.Pi/180
+	deltaLambda := (longitudeB - longitudeA) * math.Pi / 180
+	y := math.Sin(deltaLambda) * math.Cos(phiB)
+	x := math.Cos(phiA)*math.Sin(phiB) - math.Sin(phiA)*math.Cos(phiB)*math.Cos(deltaLambda)
+	return math.Mod(math.Atan2(y, x)*180/math.Pi+360, 360)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"math"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestDistance(t *testing.T) {
+	tree := NewTree(4)
+	tree.insert(&GeoPosition{Latitude: 48.8566, Longitude: 2.3522, AccuracyRadius: 20}, mustParseNetwork("192.0.2.0/24"))
+	tree.insert(&GeoPosition{Latitude: 51.5074, Longitude: -0.1278, AccuracyRadius: 5}, mustParseNetwork("198.51.100.0/24"))
+	tree.insert(&GeoPosition{Latitude: 51.5, Longitude: -0.12}, mustParseNetwork("203.0.113.0/24"))
+	distance, err := tree.Distance(net.ParseIP("192.0.2.1"), net.ParseIP("198.51.100.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(distance.Kilometers-343.5) > 1 || math.Abs(distance.Bearing-330) > 1 {
+		t.Error("Paris to London is", distance)
+	}
+	if math.Abs(distance.Confidence-(distance.Kilometers-25)/distance.Kilometers) > 1e-9 {
+		t.Error("confidence should account for both accuracy radii but was", distance.Confidence)
+	}
+	if distance, _ := tree.Distance(net.ParseIP("192.0.2.1"), net.ParseIP("203.0.113.1")); distance.Confidence != 0 {
+		t.Error("a position without an accuracy radius should not be trusted but confidence was", distance.Confidence)
+	}
+	tree.insert(nil, mustParseNetwork("198.51.100.128/25"))
+	if distance, _ := tree.Distance(net.ParseIP("192.0.2.1"), net.ParseIP("198.51.100.129")); distance.Confidence != 0 {
+		t.Error("a position reached by falling back to an ancestor should not be trusted but confidence was", distance.Confidence)
+	}
+	if _, err := tree.Distance(net.ParseIP("192.0.2.1"), net.ParseIP("10.0.0.1")); err == nil {
+		t.Error("an address without a position did not return an error")
+	}
+}
+
+func TestImpossibleTravel(t *testing.T) {
+	tree := NewTree(4)
+	tree.insert(&GeoPosition{Latitude: 48.8566, Longitude: 2.3522, AccuracyRadius: 20}, mustParseNetwork("192.0.2.0/24"))
+	tree.insert(&GeoPosition{Latitude: 40.7128, Longitude: -74.006, AccuracyRadius: 20}, mustParseNetwork("198.51.100.0/24"))
+	login := time.Date(2019, 1, 7, 12, 0, 0, 0, time.UTC)
+	for _, test := range []struct {
+		elapsed    time.Duration
+		impossible bool
+	}{{time.Hour, true}, {12 * time.Hour, false}, {0, true}} {
+		impossible, err := tree.ImpossibleTravel(net.ParseIP("192.0.2.1"), login,
+			net.ParseIP("198.51.100.1"), login.Add(test.elapsed), 1000)
+		if err != nil || impossible != test.impossible {
+			t.Errorf("Paris to New York in %v returned %v, %v", test.elapsed, impossible, err)
+		}
+	}
+}
@@ -4,13 +4,13 @@ import (
 	"bufio"
 	"encoding/csv"
 	"io"
-	"log"
-	"os"
 	"path"
+	"runtime"
 	"strconv"
+	"strings"
+	"sync"
 	"sync/atomic"
-
-	"github.com/demskie/subnetmath"
+	"time"
 )
 
 // https://dev.maxmind.com/geoip/geoip2/geolite2/
@@ -20,9 +20,40 @@ const cityBlocksV4Path = basePath + "GeoLite2-City-Blocks-IPv4.csv"
 const cityBlocksV6Path = basePath + "GeoLite2-City-Blocks-IPv6.csv"
 
 type GeoPosition struct {
-	Latitude  float64      `json:"latitude"`
-	Longitude float64      `json:"longitude"`
-	Location  *GeoLocation `json:"location"`
+	Latitude       float64      `json:"latitude"`
+	Longitude      float64      `json:"longitude"`
+	Location       *GeoLocation `json:"location"`
+	AccuracyRadius uint16       `json:"accuracyRadius"` // kilometers, zero when unknown
+	Source         Source       `json:"source"`
+	Allocation     *Allocation  `json:"allocation,omitempty"` // only set for networks read from RIR files
+}
+
+// Source identifies the dataset that a GeoPosition was read from
+type Source uint8
+
+const (
+	SourceUnknown Source = iota
+	SourceGeoLite
+	SourceARIN
+	SourceRIPENCC
+	SourceAPNIC
+	SourceAFRINIC
+	SourceLACNIC
+	SourceOverride
+)
+
+var sourceNames = []string{"unknown", "geolite2-city", "arin", "ripencc", "apnic", "afrinic", "lacnic", "override"}
+
+func (s Source) String() string {
+	if int(s) < len(sourceNames) {
+		return sourceNames[s]
+	}
+	return sourceNames[SourceUnknown]
+}
+
+// MarshalText encodes the Source by name
+func (s Source) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
 }
 
 type GeoLocation struct {
@@ -33,66 +64,178 @@ type GeoLocation struct {
 	IsPartOfEU  bool   `json:"isPartOfEU"`
 }
 
+const geoliteBatchSize = 4096
+
+// ingestGeoliteData builds the IPv4 and IPv6 subtrees concurrently since they never overlap
 func ingestGeoliteData(tree *Tree) {
-	locationMap := getAllGeoLocations()
-	gopath, _ := os.LookupEnv("GOPATH")
-	for _, blocks := range []string{cityBlocksV4Path, cityBlocksV6Path} {
-		txtFile, err := os.Open(path.Join(gopath, blocks))
+	locationMap := getAllGeoLocations(tree)
+	blockPaths := []string{cityBlocksV4Path, cityBlocksV6Path}
+	results := make([]struct {
+		roots, rootsV6 []*Node
+		size           int
+		err            error
+		sources        []SourceMetadata
+	}, len(blockPaths))
+	var wg sync.WaitGroup
+	for i := range blockPaths {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			reader := newGeoliteReader(locationMap, blockPaths[i])
+			results[i].roots, results[i].rootsV6, results[i].size, results[i].err = tree.buildNodes(reader.next)
+			for range reader.batches {
+			}
+			results[i].sources = reader.sources
+		}(i)
+	}
+	wg.Wait()
+	for i, result := range results {
+		if result.err != nil {
+			fatalf("unable to ingest %v because: %v", blockPaths[i], result.err)
+		}
+		if (len(tree.Roots) > 0 && len(result.roots) > 0) || (len(tree.RootsV6) > 0 && len(result.rootsV6) > 0) {
+			fatalf("unable to ingest %v because it overlaps another blocks file", blockPaths[i])
+		}
+		tree.Roots = append(tree.Roots, result.roots...)
+		tree.RootsV6 = append(tree.RootsV6, result.rootsV6...)
+		tree.Size += result.size
+		tree.addSources(result.sources...)
+	}
+	tree.modified()
+}
+
+type geoliteBlock struct {
+	network     Network
+	geoPosition *GeoPosition
+}
+
+// geoliteReader parses the city blocks files on a pool of workers and hands
+// the blocks back in file order, which is already sorted by network
+type geoliteReader struct {
+	batches chan chan []geoliteBlock
+	current []geoliteBlock
+	sources []SourceMetadata // complete once batches is closed
+}
+
+func newGeoliteReader(locationMap map[string]*GeoLocation, paths ...string) *geoliteReader {
+	r := &geoliteReader{batches: make(chan chan []geoliteBlock, 2*runtime.NumCPU())}
+	go r.read(locationMap, paths)
+	return r
+}
+
+func (r *geoliteReader) read(locationMap map[string]*GeoLocation, paths []string) {
+	defer close(r.batches)
+	jobs := make(chan func())
+	defer close(jobs)
+	for i := 0; i < runtime.NumCPU(); i++ {
+		go func() {
+			for job := range jobs {
+				job()
+			}
+		}()
+	}
+	for _, blocksPath := range paths {
+		txtFile, err := openInput(blocksPath)
 		if err != nil {
-			log.Fatalf("unable to ingest city location data because: %v", err)
+			fatalf("unable to ingest city blocks data because: %v", err)
 		}
-		reader := csv.NewReader(bufio.NewReader(txtFile))
-		reader.Read() // skip the first line
-		for i := 1; true; i++ {
-			lineColumns, err := reader.Read()
-			if err == io.EOF {
+		fileProgress := progress.track(path.Base(blocksPath))
+		scanner := bufio.NewScanner(txtFile)
+		scanner.Scan() // skip the first line
+		line := 1
+		for {
+			lines := make([]string, 0, geoliteBatchSize)
+			for len(lines) < geoliteBatchSize && scanner.Scan() {
+				lines = append(lines, scanner.Text())
+			}
+			if len(lines) == 0 {
 				break
 			}
-			if len(lineColumns) > 9 {
-				network := subnetmath.ParseNetworkCIDR(lineColumns[0])
-				if network == nil {
-					log.Fatalf("network '%v' is not valid", lineColumns[0])
-				}
-				if lineColumns[1] == "" && lineColumns[2] == "" {
-					continue
-				}
-				geoLocation := locationMap[lineColumns[1]]
-				if geoLocation == nil {
-					geoLocation = locationMap[lineColumns[2]]
-					if geoLocation == nil {
-						log.Fatalf("geoname_id '%v' and '%v' on line %v not found in city locations",
-							lineColumns[1], lineColumns[2], i)
-					}
-				}
-				latitude, latError := strconv.ParseFloat(lineColumns[7], 64)
-				longitude, longError := strconv.ParseFloat(lineColumns[8], 64)
-				if latError != nil || longError != nil {
-					coarsePosition, exists := coarseCountryPositions[geoLocation.CountryISO]
-					if !exists {
-						log.Fatalf("latitude '%v' is not valid and countrycode '%v' is unsupported",
-							lineColumns[7], geoLocation.CountryISO)
-					}
-					latitude = coarsePosition.Latitude
-					longitude = coarsePosition.Longitude
-				}
-				geoPosition := &GeoPosition{
-					Latitude:  latitude,
-					Longitude: longitude,
-					Location:  geoLocation,
-				}
-				atomic.AddUint64(&counters.rate, 1)
-				tree.insert(geoPosition, network)
+			result := make(chan []geoliteBlock, 1)
+			r.batches <- result
+			firstLine := line
+			jobs <- func() {
+				result <- parseGeoliteBlocks(locationMap, fileProgress, lines, firstLine)
+			}
+			line += len(lines)
+		}
+		if err := scanner.Err(); err != nil {
+			fatalf("unable to ingest city blocks data because: %v", err)
+		}
+		r.sources = append(r.sources, txtFile.close(uint64(line-1), time.Time{}))
+	}
+}
+
+func (r *geoliteReader) next() (Network, *GeoPosition, bool) {
+	for len(r.current) == 0 {
+		batch, ok := <-r.batches
+		if !ok {
+			return Network{}, nil, false
+		}
+		r.current = <-batch
+	}
+	block := r.current[0]
+	r.current = r.current[1:]
+	return block.network, block.geoPosition, true
+}
+
+func parseGeoliteBlocks(locationMap map[string]*GeoLocation, fileProgress *fileProgress,
+	lines []string, firstLine int) []geoliteBlock {
+	result := make([]geoliteBlock, 0, len(lines))
+	reader := csv.NewReader(strings.NewReader(strings.Join(lines, "\n")))
+	reader.FieldsPerRecord = -1
+	for i := firstLine; true; i++ {
+		lineColumns, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if len(lineColumns) <= 9 {
+			continue
+		}
+		network, err := ParseNetwork(lineColumns[0])
+		if err != nil {
+			fatalf("network '%v' is not valid", lineColumns[0])
+		}
+		if lineColumns[1] == "" && lineColumns[2] == "" {
+			continue
+		}
+		geoLocation := locationMap[lineColumns[1]]
+		if geoLocation == nil {
+			geoLocation = locationMap[lineColumns[2]]
+			if geoLocation == nil {
+				fatalf("geoname_id '%v' and '%v' on line %v not found in city locations",
+					lineColumns[1], lineColumns[2], i)
+			}
+		}
+		latitude, latError := strconv.ParseFloat(lineColumns[7], 64)
+		longitude, longError := strconv.ParseFloat(lineColumns[8], 64)
+		if latError != nil || longError != nil {
+			coarsePosition := coarseCountryPositions[geoLocation.CountryISO]
+			if coarsePosition == nil {
+				fatalf("latitude '%v' is not valid and countrycode '%v' is unsupported",
+					lineColumns[7], geoLocation.CountryISO)
 			}
+			latitude = coarsePosition.Latitude
+			longitude = coarsePosition.Longitude
 		}
+		accuracyRadius, _ := strconv.ParseUint(lineColumns[9], 10, 16)
+		result = append(result, geoliteBlock{network, &GeoPosition{
+			Latitude:       latitude,
+			Longitude:      longitude,
+			Location:       geoLocation,
+			AccuracyRadius: uint16(accuracyRadius),
+			Source:         SourceGeoLite,
+		}})
 	}
+	atomic.AddUint64(&fileProgress.records, uint64(len(lines)))
+	return result
 }
 
-func getAllGeoLocations() map[string]*GeoLocation {
+func getAllGeoLocations(tree *Tree) map[string]*GeoLocation {
 	result := map[string]*GeoLocation{}
-	gopath, _ := os.LookupEnv("GOPATH")
-	txtFile, err := os.Open(path.Join(gopath, cityLocationsPath))
+	txtFile, err := openInput(cityLocationsPath)
 	if err != nil {
-		log.Fatalf("unable to ingest city location data because: %v", err)
+		fatalf("unable to ingest city location data because: %v", err)
 	}
 	reader := csv.NewReader(bufio.NewReader(txtFile))
 	reader.Read() // skip the first line
@@ -111,261 +254,262 @@ func getAllGeoLocations() map[string]*GeoLocation {
 			}
 		}
 	}
+	tree.addSources(txtFile.close(uint64(len(result)), time.Time{}))
 	return result
 }
 
 var coarseCountryPositions = map[string]*GeoPosition{
-	"AL": &GeoPosition{41, 20, nil},
-	"DZ": &GeoPosition{28, 3, nil},
-	"AS": &GeoPosition{-14.3333, -170, nil},
-	"AD": &GeoPosition{42.5, 1.6, nil},
-	"AO": &GeoPosition{-12.5, 18.5, nil},
-	"AI": &GeoPosition{18.25, -63.1667, nil},
-	"AQ": &GeoPosition{-90, 0, nil},
-	"AG": &GeoPosition{17.05, -61.8, nil},
-	"AR": &GeoPosition{-34, -64, nil},
-	"AM": &GeoPosition{40, 45, nil},
-	"AW": &GeoPosition{12.5, -69.9667, nil},
-	"AU": &GeoPosition{-27, 133, nil},
-	"AT": &GeoPosition{47.3333, 13.3333, nil},
-	"AZ": &GeoPosition{40.5, 47.5, nil},
-	"BS": &GeoPosition{24.25, -76, nil},
-	"BH": &GeoPosition{26, 50.55, nil},
-	"BD": &GeoPosition{24, 90, nil},
-	"BB": &GeoPosition{13.1667, -59.5333, nil},
-	"BY": &GeoPosition{53, 28, nil},
-	"BE": &GeoPosition{50.8333, 4, nil},
-	"BZ": &GeoPosition{17.25, -88.75, nil},
-	"BJ": &GeoPosition{9.5, 2.25, nil},
-	"BM": &GeoPosition{32.3333, -64.75, nil},
-	"BT": &GeoPosition{27.5, 90.5, nil},
-	"BO": &GeoPosition{-17, -65, nil},
-	"BA": &GeoPosition{44, 18, nil},
-	"BW": &GeoPosition{-22, 24, nil},
-	"BV": &GeoPosition{-54.4333, 3.4, nil},
-	"BR": &GeoPosition{-10, -55, nil},
-	"IO": &GeoPosition{-6, 71.5, nil},
-	"BN": &GeoPosition{4.5, 114.6667, nil},
-	"BG": &GeoPosition{43, 25, nil},
-	"BF": &GeoPosition{13, -2, nil},
-	"BI": &GeoPosition{-3.5, 30, nil},
-	"KH": &GeoPosition{13, 105, nil},
-	"CM": &GeoPosition{6, 12, nil},
-	"CA": &GeoPosition{60, -95, nil},
-	"CV": &GeoPosition{16, -24, nil},
-	"KY": &GeoPosition{19.5, -80.5, nil},
-	"CF": &GeoPosition{7, 21, nil},
-	"TD": &GeoPosition{15, 19, nil},
-	"CL": &GeoPosition{-30, -71, nil},
-	"CN": &GeoPosition{35, 105, nil},
-	"CX": &GeoPosition{-10.5, 105.6667, nil},
-	"CC": &GeoPosition{-12.5, 96.8333, nil},
-	"CO": &GeoPosition{4, -72, nil},
-	"KM": &GeoPosition{-12.1667, 44.25, nil},
-	"CG": &GeoPosition{-1, 15, nil},
-	"CD": &GeoPosition{0, 25, nil},
-	"CK": &GeoPosition{-21.2333, -159.7667, nil},
-	"CR": &GeoPosition{10, -84, nil},
-	"CI": &GeoPosition{8, -5, nil},
-	"HR": &GeoPosition{45.1667, 15.5, nil},
-	"CU": &GeoPosition{21.5, -80, nil},
-	"CY": &GeoPosition{35, 33, nil},
-	"CZ": &GeoPosition{49.75, 15.5, nil},
-	"DK": &GeoPosition{56, 10, nil},
-	"DJ": &GeoPosition{11.5, 43, nil},
-	"DM": &GeoPosition{15.4167, -61.3333, nil},
-	"DO": &GeoPosition{19, -70.6667, nil},
-	"EC": &GeoPosition{-2, -77.5, nil},
-	"EG": &GeoPosition{27, 30, nil},
-	"SV": &GeoPosition{13.8333, -88.9167, nil},
-	"GQ": &GeoPosition{2, 10, nil},
-	"ER": &GeoPosition{15, 39, nil},
-	"EE": &GeoPosition{59, 26, nil},
-	"ET": &GeoPosition{8, 38, nil},
-	"FK": &GeoPosition{-51.75, -59, nil},
-	"FO": &GeoPosition{62, -7, nil},
-	"FJ": &GeoPosition{-18, 175, nil},
-	"FI": &GeoPosition{64, 26, nil},
-	"FR": &GeoPosition{46, 2, nil},
-	"GF": &GeoPosition{4, -53, nil},
-	"PF": &GeoPosition{-15, -140, nil},
-	"TF": &GeoPosition{-43, 67, nil},
-	"GA": &GeoPosition{-1, 11.75, nil},
-	"GM": &GeoPosition{13.4667, -16.5667, nil},
-	"GE": &GeoPosition{42, 43.5, nil},
-	"DE": &GeoPosition{51, 9, nil},
-	"GH": &GeoPosition{8, -2, nil},
-	"GI": &GeoPosition{36.1833, -5.3667, nil},
-	"GR": &GeoPosition{39, 22, nil},
-	"GL": &GeoPosition{72, -40, nil},
-	"GD": &GeoPosition{12.1167, -61.6667, nil},
-	"GP": &GeoPosition{16.25, -61.5833, nil},
-	"GU": &GeoPosition{13.4667, 144.7833, nil},
-	"GT": &GeoPosition{15.5, -90.25, nil},
-	"GG": &GeoPosition{49.5, -2.56, nil},
-	"GN": &GeoPosition{11, -10, nil},
-	"GW": &GeoPosition{12, -15, nil},
-	"GY": &GeoPosition{5, -59, nil},
-	"HT": &GeoPosition{19, -72.4167, nil},
-	"HM": &GeoPosition{-53.1, 72.5167, nil},
-	"VA": &GeoPosition{41.9, 12.45, nil},
-	"HN": &GeoPosition{15, -86.5, nil},
-	"HK": &GeoPosition{22.25, 114.1667, nil},
-	"HU": &GeoPosition{47, 20, nil},
-	"IS": &GeoPosition{65, -18, nil},
-	"IN": &GeoPosition{20, 77, nil},
-	"ID": &GeoPosition{-5, 120, nil},
-	"IR": &GeoPosition{32, 53, nil},
-	"IQ": &GeoPosition{33, 44, nil},
-	"IE": &GeoPosition{53, -8, nil},
-	"IM": &GeoPosition{54.23, -4.55, nil},
-	"IL": &GeoPosition{31.5, 34.75, nil},
-	"IT": &GeoPosition{42.8333, 12.8333, nil},
-	"JM": &GeoPosition{18.25, -77.5, nil},
-	"JP": &GeoPosition{36, 138, nil},
-	"JE": &GeoPosition{49.21, -2.13, nil},
-	"JO": &GeoPosition{31, 36, nil},
-	"KZ": &GeoPosition{48, 68, nil},
-	"KE": &GeoPosition{1, 38, nil},
-	"KI": &GeoPosition{1.4167, 173, nil},
-	"KP": &GeoPosition{40, 127, nil},
-	"KR": &GeoPosition{37, 127.5, nil},
-	"KW": &GeoPosition{29.3375, 47.6581, nil},
-	"KG": &GeoPosition{41, 75, nil},
-	"LA": &GeoPosition{18, 105, nil},
-	"LV": &GeoPosition{57, 25, nil},
-	"LB": &GeoPosition{33.8333, 35.8333, nil},
-	"LS": &GeoPosition{-29.5, 28.5, nil},
-	"LR": &GeoPosition{6.5, -9.5, nil},
-	"LY": &GeoPosition{25, 17, nil},
-	"LI": &GeoPosition{47.1667, 9.5333, nil},
-	"LT": &GeoPosition{56, 24, nil},
-	"LU": &GeoPosition{49.75, 6.1667, nil},
-	"MO": &GeoPosition{22.1667, 113.55, nil},
-	"MK": &GeoPosition{41.8333, 22, nil},
-	"MG": &GeoPosition{-20, 47, nil},
-	"MW": &GeoPosition{-13.5, 34, nil},
-	"MY": &GeoPosition{2.5, 112.5, nil},
-	"MV": &GeoPosition{3.25, 73, nil},
-	"ML": &GeoPosition{17, -4, nil},
-	"MT": &GeoPosition{35.8333, 14.5833, nil},
-	"MH": &GeoPosition{9, 168, nil},
-	"MQ": &GeoPosition{14.6667, -61, nil},
-	"MR": &GeoPosition{20, -12, nil},
-	"MU": &GeoPosition{-20.2833, 57.55, nil},
-	"YT": &GeoPosition{-12.8333, 45.1667, nil},
-	"MX": &GeoPosition{23, -102, nil},
-	"FM": &GeoPosition{6.9167, 158.25, nil},
-	"MD": &GeoPosition{47, 29, nil},
-	"MC": &GeoPosition{43.7333, 7.4, nil},
-	"MN": &GeoPosition{46, 105, nil},
-	"ME": &GeoPosition{42, 19, nil},
-	"MS": &GeoPosition{16.75, -62.2, nil},
-	"MA": &GeoPosition{32, -5, nil},
-	"MZ": &GeoPosition{-18.25, 35, nil},
-	"MM": &GeoPosition{22, 98, nil},
-	"NA": &GeoPosition{-22, 17, nil},
-	"NR": &GeoPosition{-0.5333, 166.9167, nil},
-	"NP": &GeoPosition{28, 84, nil},
-	"NL": &GeoPosition{52.5, 5.75, nil},
-	"AN": &GeoPosition{12.25, -68.75, nil},
-	"NC": &GeoPosition{-21.5, 165.5, nil},
-	"NZ": &GeoPosition{-41, 174, nil},
-	"NI": &GeoPosition{13, -85, nil},
-	"NE": &GeoPosition{16, 8, nil},
-	"NG": &GeoPosition{10, 8, nil},
-	"NU": &GeoPosition{-19.0333, -169.8667, nil},
-	"NF": &GeoPosition{-29.0333, 167.95, nil},
-	"MP": &GeoPosition{15.2, 145.75, nil},
-	"NO": &GeoPosition{62, 10, nil},
-	"OM": &GeoPosition{21, 57, nil},
-	"PK": &GeoPosition{30, 70, nil},
-	"PW": &GeoPosition{7.5, 134.5, nil},
-	"PS": &GeoPosition{32, 35.25, nil},
-	"PA": &GeoPosition{9, -80, nil},
-	"PG": &GeoPosition{-6, 147, nil},
-	"PY": &GeoPosition{-23, -58, nil},
-	"PE": &GeoPosition{-10, -76, nil},
-	"PH": &GeoPosition{13, 122, nil},
-	"PN": &GeoPosition{-24.7, -127.4, nil},
-	"PL": &GeoPosition{52, 20, nil},
-	"PT": &GeoPosition{39.5, -8, nil},
-	"PR": &GeoPosition{18.25, -66.5, nil},
-	"QA": &GeoPosition{25.5, 51.25, nil},
-	"RE": &GeoPosition{-21.1, 55.6, nil},
-	"RO": &GeoPosition{46, 25, nil},
-	"RU": &GeoPosition{60, 100, nil},
-	"RW": &GeoPosition{-2, 30, nil},
-	"SH": &GeoPosition{-15.9333, -5.7, nil},
-	"KN": &GeoPosition{17.3333, -62.75, nil},
-	"LC": &GeoPosition{13.8833, -61.1333, nil},
-	"PM": &GeoPosition{46.8333, -56.3333, nil},
-	"VC": &GeoPosition{13.25, -61.2, nil},
-	"WS": &GeoPosition{-13.5833, -172.3333, nil},
-	"SM": &GeoPosition{43.7667, 12.4167, nil},
-	"ST": &GeoPosition{1, 7, nil},
-	"SA": &GeoPosition{25, 45, nil},
-	"SN": &GeoPosition{14, -14, nil},
-	"RS": &GeoPosition{44, 21, nil},
-	"SC": &GeoPosition{-4.5833, 55.6667, nil},
-	"SL": &GeoPosition{8.5, -11.5, nil},
-	"SG": &GeoPosition{1.3667, 103.8, nil},
-	"SK": &GeoPosition{48.6667, 19.5, nil},
-	"SI": &GeoPosition{46, 15, nil},
-	"SB": &GeoPosition{-8, 159, nil},
-	"SO": &GeoPosition{10, 49, nil},
-	"ZA": &GeoPosition{-29, 24, nil},
-	"GS": &GeoPosition{-54.5, -37, nil},
-	"ES": &GeoPosition{40, -4, nil},
-	"LK": &GeoPosition{7, 81, nil},
-	"SD": &GeoPosition{15, 30, nil},
-	"SR": &GeoPosition{4, -56, nil},
-	"SJ": &GeoPosition{78, 20, nil},
-	"SZ": &GeoPosition{-26.5, 31.5, nil},
-	"SE": &GeoPosition{62, 15, nil},
-	"CH": &GeoPosition{47, 8, nil},
-	"SY": &GeoPosition{35, 38, nil},
-	"TW": &GeoPosition{23.5, 121, nil},
-	"TJ": &GeoPosition{39, 71, nil},
-	"TZ": &GeoPosition{-6, 35, nil},
-	"TH": &GeoPosition{15, 100, nil},
-	"TL": &GeoPosition{-8.55, 125.5167, nil},
-	"TG": &GeoPosition{8, 1.1667, nil},
-	"TK": &GeoPosition{-9, -172, nil},
-	"TO": &GeoPosition{-20, -175, nil},
-	"TT": &GeoPosition{11, -61, nil},
-	"TN": &GeoPosition{34, 9, nil},
-	"TR": &GeoPosition{39, 35, nil},
-	"TM": &GeoPosition{40, 60, nil},
-	"TC": &GeoPosition{21.75, -71.5833, nil},
-	"TV": &GeoPosition{-8, 178, nil},
-	"UG": &GeoPosition{1, 32, nil},
-	"UA": &GeoPosition{49, 32, nil},
-	"AE": &GeoPosition{24, 54, nil},
-	"GB": &GeoPosition{54, -2, nil},
-	"US": &GeoPosition{38, -97, nil},
-	"UM": &GeoPosition{19.2833, 166.6, nil},
-	"UY": &GeoPosition{-33, -56, nil},
-	"UZ": &GeoPosition{41, 64, nil},
-	"VU": &GeoPosition{-16, 167, nil},
-	"VE": &GeoPosition{8, -66, nil},
-	"VN": &GeoPosition{16, 106, nil},
-	"VG": &GeoPosition{18.5, -64.5, nil},
-	"VI": &GeoPosition{18.3333, -64.8333, nil},
-	"WF": &GeoPosition{-13.3, -176.2, nil},
-	"EH": &GeoPosition{24.5, -13, nil},
-	"YE": &GeoPosition{15, 48, nil},
-	"ZM": &GeoPosition{-15, 30, nil},
-	"ZW": &GeoPosition{-20, 30, nil},
-	"AF": &GeoPosition{33, 65, nil},
+	"AL": &GeoPosition{Latitude: 41, Longitude: 20},
+	"DZ": &GeoPosition{Latitude: 28, Longitude: 3},
+	"AS": &GeoPosition{Latitude: -14.3333, Longitude: -170},
+	"AD": &GeoPosition{Latitude: 42.5, Longitude: 1.6},
+	"AO": &GeoPosition{Latitude: -12.5, Longitude: 18.5},
+	"AI": &GeoPosition{Latitude: 18.25, Longitude: -63.1667},
+	"AQ": &GeoPosition{Latitude: -90, Longitude: 0},
+	"AG": &GeoPosition{Latitude: 17.05, Longitude: -61.8},
+	"AR": &GeoPosition{Latitude: -34, Longitude: -64},
+	"AM": &GeoPosition{Latitude: 40, Longitude: 45},
+	"AW": &GeoPosition{Latitude: 12.5, Longitude: -69.9667},
+	"AU": &GeoPosition{Latitude: -27, Longitude: 133},
+	"AT": &GeoPosition{Latitude: 47.3333, Longitude: 13.3333},
+	"AZ": &GeoPosition{Latitude: 40.5, Longitude: 47.5},
+	"BS": &GeoPosition{Latitude: 24.25, Longitude: -76},
+	"BH": &GeoPosition{Latitude: 26, Longitude: 50.55},
+	"BD": &GeoPosition{Latitude: 24, Longitude: 90},
+	"BB": &GeoPosition{Latitude: 13.1667, Longitude: -59.5333},
+	"BY": &GeoPosition{Latitude: 53, Longitude: 28},
+	"BE": &GeoPosition{Latitude: 50.8333, Longitude: 4},
+	"BZ": &GeoPosition{Latitude: 17.25, Longitude: -88.75},
+	"BJ": &GeoPosition{Latitude: 9.5, Longitude: 2.25},
+	"BM": &GeoPosition{Latitude: 32.3333, Longitude: -64.75},
+	"BT": &GeoPosition{Latitude: 27.5, Longitude: 90.5},
+	"BO": &GeoPosition{Latitude: -17, Longitude: -65},
+	"BA": &GeoPosition{Latitude: 44, Longitude: 18},
+	"BW": &GeoPosition{Latitude: -22, Longitude: 24},
+	"BV": &GeoPosition{Latitude: -54.4333, Longitude: 3.4},
+	"BR": &GeoPosition{Latitude: -10, Longitude: -55},
+	"IO": &GeoPosition{Latitude: -6, Longitude: 71.5},
+	"BN": &GeoPosition{Latitude: 4.5, Longitude: 114.6667},
+	"BG": &GeoPosition{Latitude: 43, Longitude: 25},
+	"BF": &GeoPosition{Latitude: 13, Longitude: -2},
+	"BI": &GeoPosition{Latitude: -3.5, Longitude: 30},
+	"KH": &GeoPosition{Latitude: 13, Longitude: 105},
+	"CM": &GeoPosition{Latitude: 6, Longitude: 12},
+	"CA": &GeoPosition{Latitude: 60, Longitude: -95},
+	"CV": &GeoPosition{Latitude: 16, Longitude: -24},
+	"KY": &GeoPosition{Latitude: 19.5, Longitude: -80.5},
+	"CF": &GeoPosition{Latitude: 7, Longitude: 21},
+	"TD": &GeoPosition{Latitude: 15, Longitude: 19},
+	"CL": &GeoPosition{Latitude: -30, Longitude: -71},
+	"CN": &GeoPosition{Latitude: 35, Longitude: 105},
+	"CX": &GeoPosition{Latitude: -10.5, Longitude: 105.6667},
+	"CC": &GeoPosition{Latitude: -12.5, Longitude: 96.8333},
+	"CO": &GeoPosition{Latitude: 4, Longitude: -72},
+	"KM": &GeoPosition{Latitude: -12.1667, Longitude: 44.25},
+	"CG": &GeoPosition{Latitude: -1, Longitude: 15},
+	"CD": &GeoPosition{Latitude: 0, Longitude: 25},
+	"CK": &GeoPosition{Latitude: -21.2333, Longitude: -159.7667},
+	"CR": &GeoPosition{Latitude: 10, Longitude: -84},
+	"CI": &GeoPosition{Latitude: 8, Longitude: -5},
+	"HR": &GeoPosition{Latitude: 45.1667, Longitude: 15.5},
+	"CU": &GeoPosition{Latitude: 21.5, Longitude: -80},
+	"CY": &GeoPosition{Latitude: 35, Longitude: 33},
+	"CZ": &GeoPosition{Latitude: 49.75, Longitude: 15.5},
+	"DK": &GeoPosition{Latitude: 56, Longitude: 10},
+	"DJ": &GeoPosition{Latitude: 11.5, Longitude: 43},
+	"DM": &GeoPosition{Latitude: 15.4167, Longitude: -61.3333},
+	"DO": &GeoPosition{Latitude: 19, Longitude: -70.6667},
+	"EC": &GeoPosition{Latitude: -2, Longitude: -77.5},
+	"EG": &GeoPosition{Latitude: 27, Longitude: 30},
+	"SV": &GeoPosition{Latitude: 13.8333, Longitude: -88.9167},
+	"GQ": &GeoPosition{Latitude: 2, Longitude: 10},
+	"ER": &GeoPosition{Latitude: 15, Longitude: 39},
+	"EE": &GeoPosition{Latitude: 59, Longitude: 26},
+	"ET": &GeoPosition{Latitude: 8, Longitude: 38},
+	"FK": &GeoPosition{Latitude: -51.75, Longitude: -59},
+	"FO": &GeoPosition{Latitude: 62, Longitude: -7},
+	"FJ": &GeoPosition{Latitude: -18, Longitude: 175},
+	"FI": &GeoPosition{Latitude: 64, Longitude: 26},
+	"FR": &GeoPosition{Latitude: 46, Longitude: 2},
+	"GF": &GeoPosition{Latitude: 4, Longitude: -53},
+	"PF": &GeoPosition{Latitude: -15, Longitude: -140},
+	"TF": &GeoPosition{Latitude: -43, Longitude: 67},
+	"GA": &GeoPosition{Latitude: -1, Longitude: 11.75},
+	"GM": &GeoPosition{Latitude: 13.4667, Longitude: -16.5667},
+	"GE": &GeoPosition{Latitude: 42, Longitude: 43.5},
+	"DE": &GeoPosition{Latitude: 51, Longitude: 9},
+	"GH": &GeoPosition{Latitude: 8, Longitude: -2},
+	"GI": &GeoPosition{Latitude: 36.1833, Longitude: -5.3667},
+	"GR": &GeoPosition{Latitude: 39, Longitude: 22},
+	"GL": &GeoPosition{Latitude: 72, Longitude: -40},
+	"GD": &GeoPosition{Latitude: 12.1167, Longitude: -61.6667},
+	"GP": &GeoPosition{Latitude: 16.25, Longitude: -61.5833},
+	"GU": &GeoPosition{Latitude: 13.4667, Longitude: 144.7833},
+	"GT": &GeoPosition{Latitude: 15.5, Longitude: -90.25},
+	"GG": &GeoPosition{Latitude: 49.5, Longitude: -2.56},
+	"GN": &GeoPosition{Latitude: 11, Longitude: -10},
+	"GW": &GeoPosition{Latitude: 12, Longitude: -15},
+	"GY": &GeoPosition{Latitude: 5, Longitude: -59},
+	"HT": &GeoPosition{Latitude: 19, Longitude: -72.4167},
+	"HM": &GeoPosition{Latitude: -53.1, Longitude: 72.5167},
+	"VA": &GeoPosition{Latitude: 41.9, Longitude: 12.45},
+	"HN": &GeoPosition{Latitude: 15, Longitude: -86.5},
+	"HK": &GeoPosition{Latitude: 22.25, Longitude: 114.1667},
+	"HU": &GeoPosition{Latitude: 47, Longitude: 20},
+	"IS": &GeoPosition{Latitude: 65, Longitude: -18},
+	"IN": &GeoPosition{Latitude: 20, Longitude: 77},
+	"ID": &GeoPosition{Latitude: -5, Longitude: 120},
+	"IR": &GeoPosition{Latitude: 32, Longitude: 53},
+	"IQ": &GeoPosition{Latitude: 33, Longitude: 44},
+	"IE": &GeoPosition{Latitude: 53, Longitude: -8},
+	"IM": &GeoPosition{Latitude: 54.23, Longitude: -4.55},
+	"IL": &GeoPosition{Latitude: 31.5, Longitude: 34.75},
+	"IT": &GeoPosition{Latitude: 42.8333, Longitude: 12.8333},
+	"JM": &GeoPosition{Latitude: 18.25, Longitude: -77.5},
+	"JP": &GeoPosition{Latitude: 36, Longitude: 138},
+	"JE": &GeoPosition{Latitude: 49.21, Longitude: -2.13},
+	"JO": &GeoPosition{Latitude: 31, Longitude: 36},
+	"KZ": &GeoPosition{Latitude: 48, Longitude: 68},
+	"KE": &GeoPosition{Latitude: 1, Longitude: 38},
+	"KI": &GeoPosition{Latitude: 1.4167, Longitude: 173},
+	"KP": &GeoPosition{Latitude: 40, Longitude: 127},
+	"KR": &GeoPosition{Latitude: 37, Longitude: 127.5},
+	"KW": &GeoPosition{Latitude: 29.3375, Longitude: 47.6581},
+	"KG": &GeoPosition{Latitude: 41, Longitude: 75},
+	"LA": &GeoPosition{Latitude: 18, Longitude: 105},
+	"LV": &GeoPosition{Latitude: 57, Longitude: 25},
+	"LB": &GeoPosition{Latitude: 33.8333, Longitude: 35.8333},
+	"LS": &GeoPosition{Latitude: -29.5, Longitude: 28.5},
+	"LR": &GeoPosition{Latitude: 6.5, Longitude: -9.5},
+	"LY": &GeoPosition{Latitude: 25, Longitude: 17},
+	"LI": &GeoPosition{Latitude: 47.1667, Longitude: 9.5333},
+	"LT": &GeoPosition{Latitude: 56, Longitude: 24},
+	"LU": &GeoPosition{Latitude: 49.75, Longitude: 6.1667},
+	"MO": &GeoPosition{Latitude: 22.1667, Longitude: 113.55},
+	"MK": &GeoPosition{Latitude: 41.8333, Longitude: 22},
+	"MG": &GeoPosition{Latitude: -20, Longitude: 47},
+	"MW": &GeoPosition{Latitude: -13.5, Longitude: 34},
+	"MY": &GeoPosition{Latitude: 2.5, Longitude: 112.5},
+	"MV": &GeoPosition{Latitude: 3.25, Longitude: 73},
+	"ML": &GeoPosition{Latitude: 17, Longitude: -4},
+	"MT": &GeoPosition{Latitude: 35.8333, Longitude: 14.5833},
+	"MH": &GeoPosition{Latitude: 9, Longitude: 168},
+	"MQ": &GeoPosition{Latitude: 14.6667, Longitude: -61},
+	"MR": &GeoPosition{Latitude: 20, Longitude: -12},
+	"MU": &GeoPosition{Latitude: -20.2833, Longitude: 57.55},
+	"YT": &GeoPosition{Latitude: -12.8333, Longitude: 45.1667},
+	"MX": &GeoPosition{Latitude: 23, Longitude: -102},
+	"FM": &GeoPosition{Latitude: 6.9167, Longitude: 158.25},
+	"MD": &GeoPosition{Latitude: 47, Longitude: 29},
+	"MC": &GeoPosition{Latitude: 43.7333, Longitude: 7.4},
+	"MN": &GeoPosition{Latitude: 46, Longitude: 105},
+	"ME": &GeoPosition{Latitude: 42, Longitude: 19},
+	"MS": &GeoPosition{Latitude: 16.75, Longitude: -62.2},
+	"MA": &GeoPosition{Latitude: 32, Longitude: -5},
+	"MZ": &GeoPosition{Latitude: -18.25, Longitude: 35},
+	"MM": &GeoPosition{Latitude: 22, Longitude: 98},
+	"NA": &GeoPosition{Latitude: -22, Longitude: 17},
+	"NR": &GeoPosition{Latitude: -0.5333, Longitude: 166.9167},
+	"NP": &GeoPosition{Latitude: 28, Longitude: 84},
+	"NL": &GeoPosition{Latitude: 52.5, Longitude: 5.75},
+	"AN": &GeoPosition{Latitude: 12.25, Longitude: -68.75},
+	"NC": &GeoPosition{Latitude: -21.5, Longitude: 165.5},
+	"NZ": &GeoPosition{Latitude: -41, Longitude: 174},
+	"NI": &GeoPosition{Latitude: 13, Longitude: -85},
+	"NE": &GeoPosition{Latitude: 16, Longitude: 8},
+	"NG": &GeoPosition{Latitude: 10, Longitude: 8},
+	"NU": &GeoPosition{Latitude: -19.0333, Longitude: -169.8667},
+	"NF": &GeoPosition{Latitude: -29.0333, Longitude: 167.95},
+	"MP": &GeoPosition{Latitude: 15.2, Longitude: 145.75},
+	"NO": &GeoPosition{Latitude: 62, Longitude: 10},
+	"OM": &GeoPosition{Latitude: 21, Longitude: 57},
+	"PK": &GeoPosition{Latitude: 30, Longitude: 70},
+	"PW": &GeoPosition{Latitude: 7.5, Longitude: 134.5},
+	"PS": &GeoPosition{Latitude: 32, Longitude: 35.25},
+	"PA": &GeoPosition{Latitude: 9, Longitude: -80},
+	"PG": &GeoPosition{Latitude: -6, Longitude: 147},
+	"PY": &GeoPosition{Latitude: -23, Longitude: -58},
+	"PE": &GeoPosition{Latitude: -10, Longitude: -76},
+	"PH": &GeoPosition{Latitude: 13, Longitude: 122},
+	"PN": &GeoPosition{Latitude: -24.7, Longitude: -127.4},
+	"PL": &GeoPosition{Latitude: 52, Longitude: 20},
+	"PT": &GeoPosition{Latitude: 39.5, Longitude: -8},
+	"PR": &GeoPosition{Latitude: 18.25, Longitude: -66.5},
+	"QA": &GeoPosition{Latitude: 25.5, Longitude: 51.25},
+	"RE": &GeoPosition{Latitude: -21.1, Longitude: 55.6},
+	"RO": &GeoPosition{Latitude: 46, Longitude: 25},
+	"RU": &GeoPosition{Latitude: 60, Longitude: 100},
+	"RW": &GeoPosition{Latitude: -2, Longitude: 30},
+	"SH": &GeoPosition{Latitude: -15.9333, Longitude: -5.7},
+	"KN": &GeoPosition{Latitude: 17.3333, Longitude: -62.75},
+	"LC": &GeoPosition{Latitude: 13.8833, Longitude: -61.1333},
+	"PM": &GeoPosition{Latitude: 46.8333, Longitude: -56.3333},
+	"VC": &GeoPosition{Latitude: 13.25, Longitude: -61.2},
+	"WS": &GeoPosition{Latitude: -13.5833, Longitude: -172.3333},
+	"SM": &GeoPosition{Latitude: 43.7667, Longitude: 12.4167},
+	"ST": &GeoPosition{Latitude: 1, Longitude: 7},
+	"SA": &GeoPosition{Latitude: 25, Longitude: 45},
+	"SN": &GeoPosition{Latitude: 14, Longitude: -14},
+	"RS": &GeoPosition{Latitude: 44, Longitude: 21},
+	"SC": &GeoPosition{Latitude: -4.5833, Longitude: 55.6667},
+	"SL": &GeoPosition{Latitude: 8.5, Longitude: -11.5},
+	"SG": &GeoPosition{Latitude: 1.3667, Longitude: 103.8},
+	"SK": &GeoPosition{Latitude: 48.6667, Longitude: 19.5},
+	"SI": &GeoPosition{Latitude: 46, Longitude: 15},
+	"SB": &GeoPosition{Latitude: -8, Longitude: 159},
+	"SO": &GeoPosition{Latitude: 10, Longitude: 49},
+	"ZA": &GeoPosition{Latitude: -29, Longitude: 24},
+	"GS": &GeoPosition{Latitude: -54.5, Longitude: -37},
+	"ES": &GeoPosition{Latitude: 40, Longitude: -4},
+	"LK": &GeoPosition{Latitude: 7, Longitude: 81},
+	"SD": &GeoPosition{Latitude: 15, Longitude: 30},
+	"SR": &GeoPosition{Latitude: 4, Longitude: -56},
+	"SJ": &GeoPosition{Latitude: 78, Longitude: 20},
+	"SZ": &GeoPosition{Latitude: -26.5, Longitude: 31.5},
+	"SE": &GeoPosition{Latitude: 62, Longitude: 15},
+	"CH": &GeoPosition{Latitude: 47, Longitude: 8},
+	"SY": &GeoPosition{Latitude: 35, Longitude: 38},
+	"TW": &GeoPosition{Latitude: 23.5, Longitude: 121},
+	"TJ": &GeoPosition{Latitude: 39, Longitude: 71},
+	"TZ": &GeoPosition{Latitude: -6, Longitude: 35},
+	"TH": &GeoPosition{Latitude: 15, Longitude: 100},
+	"TL": &GeoPosition{Latitude: -8.55, Longitude: 125.5167},
+	"TG": &GeoPosition{Latitude: 8, Longitude: 1.1667},
+	"TK": &GeoPosition{Latitude: -9, Longitude: -172},
+	"TO": &GeoPosition{Latitude: -20, Longitude: -175},
+	"TT": &GeoPosition{Latitude: 11, Longitude: -61},
+	"TN": &GeoPosition{Latitude: 34, Longitude: 9},
+	"TR": &GeoPosition{Latitude: 39, Longitude: 35},
+	"TM": &GeoPosition{Latitude: 40, Longitude: 60},
+	"TC": &GeoPosition{Latitude: 21.75, Longitude: -71.5833},
+	"TV": &GeoPosition{Latitude: -8, Longitude: 178},
+	"UG": &GeoPosition{Latitude: 1, Longitude: 32},
+	"UA": &GeoPosition{Latitude: 49, Longitude: 32},
+	"AE": &GeoPosition{Latitude: 24, Longitude: 54},
+	"GB": &GeoPosition{Latitude: 54, Longitude: -2},
+	"US": &GeoPosition{Latitude: 38, Longitude: -97},
+	"UM": &GeoPosition{Latitude: 19.2833, Longitude: 166.6},
+	"UY": &GeoPosition{Latitude: -33, Longitude: -56},
+	"UZ": &GeoPosition{Latitude: 41, Longitude: 64},
+	"VU": &GeoPosition{Latitude: -16, Longitude: 167},
+	"VE": &GeoPosition{Latitude: 8, Longitude: -66},
+	"VN": &GeoPosition{Latitude: 16, Longitude: 106},
+	"VG": &GeoPosition{Latitude: 18.5, Longitude: -64.5},
+	"VI": &GeoPosition{Latitude: 18.3333, Longitude: -64.8333},
+	"WF": &GeoPosition{Latitude: -13.3, Longitude: -176.2},
+	"EH": &GeoPosition{Latitude: 24.5, Longitude: -13},
+	"YE": &GeoPosition{Latitude: 15, Longitude: 48},
+	"ZM": &GeoPosition{Latitude: -15, Longitude: 30},
+	"ZW": &GeoPosition{Latitude: -20, Longitude: 30},
+	"AF": &GeoPosition{Latitude: 33, Longitude: 65},
 	"ZZ": nil,
-	"EU": &GeoPosition{54.5260, 15.2551, nil},
-	"SS": &GeoPosition{7.8627, 29.6949, nil},
-	"CW": &GeoPosition{12.1696, 68.9900, nil},
-	"MF": &GeoPosition{18.0826, 63.0523, nil},
-	"SX": &GeoPosition{18.0425, 63.0548, nil},
-	"BQ": &GeoPosition{12.1784, 68.2385, nil},
-	"AP": &GeoPosition{34.0479, 100.6197, nil},
-	"AX": &GeoPosition{60.1785, 19.9156, nil},
-	"BL": &GeoPosition{17.9000, 62.8333, nil},
+	"EU": &GeoPosition{Latitude: 54.5260, Longitude: 15.2551},
+	"SS": &GeoPosition{Latitude: 7.8627, Longitude: 29.6949},
+	"CW": &GeoPosition{Latitude: 12.1696, Longitude: 68.9900},
+	"MF": &GeoPosition{Latitude: 18.0826, Longitude: 63.0523},
+	"SX": &GeoPosition{Latitude: 18.0425, Longitude: 63.0548},
+	"BQ": &GeoPosition{Latitude: 12.1784, Longitude: 68.2385},
+	"AP": &GeoPosition{Latitude: 34.0479, Longitude: 100.6197},
+	"AX": &GeoPosition{Latitude: 60.1785, Longitude: 19.9156},
+	"BL": &GeoPosition{Latitude: 17.9000, Longitude: 62.8333},
 }
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func writeGeoliteFixtures(t *testing.T, blocksV4, blocksV6 []string) {
+	gopath := t.TempDir()
+	t.Setenv("GOPATH", gopath)
+	if err := os.MkdirAll(path.Join(gopath, basePath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	header := "network,geoname_id,registered_country_geoname_id,represented_country_geoname_id," +
+		"is_anonymous_proxy,is_satellite_provider,postal_code,latitude,longitude,accuracy_radius\n"
+	files := map[string]string{
+		cityLocationsPath: "geoname_id,locale_code,continent_code,continent_name,country_iso_code,country_name," +
+			"subdivision_1_iso_code,subdivision_1_name,subdivision_2_iso_code,subdivision_2_name,city_name," +
+			"metro_code,time_zone,is_in_european_union\n" +
+			"1,en,EU,Europe,FR,France,IDF,Île-de-France,,,Paris,,Europe/Paris,1\n" +
+			"2,en,SA,\"South America\",BR,Brazil,SP,\"São Paulo\",,,\"São Paulo\",,America/Sao_Paulo,0\n" +
+			"3,en,EU,Europe,DE,Germany,,,,,,,Europe/Berlin,1\n" +
+			"4,en,EU,Europe,,,,,,,,,,0\n",
+		cityBlocksV4Path: header + strings.Join(blocksV4, "\n") + "\n",
+		cityBlocksV6Path: header + strings.Join(blocksV6, "\n") + "\n",
+	}
+	for name, contents := range files {
+		if err := os.WriteFile(path.Join(gopath, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestIngestGeoliteData(t *testing.T) {
+	var blocksV4 []string
+	for i := 0; i < 3*geoliteBatchSize; i++ {
+		blocksV4 = append(blocksV4, fmt.Sprintf("10.%v.%v.0/24,%v,,,0,0,,%v,2.35,20", i/256, i%256, 1+i%2, i))
+	}
+	blocksV6 := []string{
+		"2001:db8::/32,2,,,0,0,,-23.5,-46.6,100",
+		"2001:db8:1::/48,,,,0,0,,,,",
+		"2001:db8:2::/48,,1,,0,0,,,,",
+	}
+	writeGeoliteFixtures(t, blocksV4, blocksV6)
+	tree := NewTree(16)
+	ingestGeoliteData(tree)
+	for i := 0; i < 3*geoliteBatchSize; i++ {
+		network := mustParseNetwork(fmt.Sprintf("10.%v.%v.0/24", i/256, i%256))
+		n := tree.findClosestSupernet(network, tree.Roots)
+		if n == nil || n.Network != network || n.GeoPosition.Latitude != float64(i) {
+			t.Fatalf("%v was ingested as %v", network, n)
+		}
+	}
+	n := tree.findClosestSupernet(mustParseNetwork("2001:db8:2::/48"), tree.RootsV6)
+	if n == nil || n.GeoPosition.Location.CountryISO != "FR" || n.GeoPosition.Latitude != 46 {
+		t.Error("2001:db8:2::/48 did not fall back to the coarse position of its registered country")
+	}
+	if n := tree.findClosestSupernet(mustParseNetwork("2001:db8:1::/48"), tree.RootsV6); n.Network.Ones() != 32 {
+		t.Error("2001:db8:1::/48 should have been skipped because it has no geoname_id")
+	}
+}
@@ -14,14 +14,18 @@ type nodeJSON struct {
 	IsPartOfEU  string     `json:"isPartOfEU"`
 	Latitude    string     `json:"latitude"`
 	Longitude   string     `json:"longitude"`
-	Children    []nodeJSON `json:"children"`
+	Children    []nodeJSON `json:"children,omitempty"`
 }
 
 func (t *Tree) JSON() string {
-	var treeJSON []nodeJSON
+	var treeJSON struct {
+		Metadata Metadata   `json:"metadata"`
+		Networks []nodeJSON `json:"networks"`
+	}
+	treeJSON.Metadata = t.Metadata
 	for _, r := range [][]*Node{t.Roots, t.RootsV6} {
 		for _, n := range r {
-			treeJSON = append(treeJSON, buildJSON(n))
+			treeJSON.Networks = append(treeJSON.Networks, buildJSON(n))
 		}
 	}
 	b, _ := json.MarshalIndent(&treeJSON, "", "  ")
@@ -29,6 +33,14 @@ func (t *Tree) JSON() string {
 }
 
 func buildJSON(n *Node) nodeJSON {
+	result := summarizeJSON(n)
+	for _, child := range n.Children {
+		result.Children = append(result.Children, buildJSON(child))
+	}
+	return result
+}
+
+func summarizeJSON(n *Node) nodeJSON {
 	result := nodeJSON{}
 	result.Network = n.Network.String()
 	if n.GeoPosition != nil {
@@ -42,8 +54,5 @@ func buildJSON(n *Node) nodeJSON {
 		result.Latitude = fmt.Sprintf("%f", n.GeoPosition.Latitude)
 		result.Longitude = fmt.Sprintf("%f", n.GeoPosition.Longitude)
 	}
-	for _, child := range n.Children {
-		result.Children = append(result.Children, buildJSON(child))
-	}
 	return result
 }
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"math/big"
+	"sort"
+)
+
+type locationKey struct {
+	countryISO, subdivName, cityName string
+}
+
+// locationIndex maps GeoLocation fields to the populated nodes that carry them
+type locationIndex struct {
+	countries    map[string][]*Node
+	subdivisions map[locationKey][]*Node
+	cities       map[locationKey][]*Node
+}
+
+func newLocationIndex(tree *Tree) *locationIndex {
+	index := &locationIndex{
+		countries:    map[string][]*Node{},
+		subdivisions: map[locationKey][]*Node{},
+		cities:       map[locationKey][]*Node{},
+	}
+	var walk func(nodes []*Node)
+	walk = func(nodes []*Node) {
+		for _, n := range nodes {
+			if n.GeoPosition != nil && n.GeoPosition.Location != nil {
+				location := n.GeoPosition.Location
+				index.countries[location.CountryISO] = append(index.countries[location.CountryISO], n)
+				subdivision := locationKey{location.CountryISO, location.SubdivName, ""}
+				index.subdivisions[subdivision] = append(index.subdivisions[subdivision], n)
+				city := locationKey{location.CountryISO, location.SubdivName, location.CityName}
+				index.cities[city] = append(index.cities[city], n)
+			}
+			walk(n.Children)
+		}
+	}
+	walk(tree.Roots)
+	walk(tree.RootsV6)
+	return index
+}
+
+func (tree *Tree) locations() *locationIndex {
+	tree.mtx.Lock()
+	defer tree.mtx.Unlock()
+	if tree.locationIndex == nil {
+		tree.locationIndex = newLocationIndex(tree)
+	}
+	return tree.locationIndex
+}
+
+// NetworksByCountry returns the populated networks located in the country ordered by address
+func (tree *Tree) NetworksByCountry(countryISO string) []*Node {
+	return tree.locations().countries[countryISO]
+}
+
+// NetworksBySubdivision returns the populated networks located in the subdivision of a country
+func (tree *Tree) NetworksBySubdivision(countryISO, subdivName string) []*Node {
+	return tree.locations().subdivisions[locationKey{countryISO, subdivName, ""}]
+}
+
+// NetworksByCity returns the populated networks located in the city
+func (tree *Tree) NetworksByCity(countryISO, subdivName, cityName string) []*Node {
+	return tree.locations().cities[locationKey{countryISO, subdivName, cityName}]
+}
+
+// NetworksInEU returns the populated networks located in member states of the European Union
+func (tree *Tree) NetworksInEU() []*Node {
+	var result []*Node
+	for _, nodes := range tree.locations().countries {
+		for _, n := range nodes {
+			if n.GeoPosition.Location.IsPartOfEU {
+				result = append(result, n)
+			}
+		}
+	}
+	return result
+}
+
+// AggregateNetworks returns the minimal set of CIDRs covering the address space that resolves to
+// the nodes. Descendants that resolve somewhere else are carved out of their ancestors.
+func AggregateNetworks(nodes []*Node) []Network {
+	matched := map[*Node]bool{}
+	for _, n := range nodes {
+		matched[n] = true
+	}
+	var networks []Network
+	for _, n := range nodes {
+		networks = append(networks, excludeNetworks(n.Network, collectHoles(n.Children, matched, nil))...)
+	}
+	return mergeNetworks(networks)
+}
+
+// collectHoles returns the outermost populated descendants that are not matched
+func collectHoles(nodes []*Node, matched map[*Node]bool, holes []Network) []Network {
+	for _, n := range nodes {
+		if n.GeoPosition != nil && !matched[n] {
+			holes = append(holes, n.Network)
+		} else {
+			holes = collectHoles(n.Children, matched, holes)
+		}
+	}
+	return holes
+}
+
+// excludeNetworks splits the network into the CIDRs that remain once the holes are removed
+func excludeNetworks(network Network, holes []Network) []Network {
+	var inside []Network
+	for _, hole := range holes {
+		if hole.Contains(network) {
+			return nil
+		}
+		if network.Contains(hole) {
+			inside = append(inside, hole)
+		}
+	}
+	if len(inside) == 0 {
+		return []Network{network}
+	}
+	lower, upper, _ := network.halves()
+	return append(excludeNetworks(lower, inside), excludeNetworks(upper, inside)...)
+}
+
+// mergeNetworks sorts the networks, drops the ones that are already covered and joins adjacent halves
+func mergeNetworks(networks []Network) []Network {
+	sort.Slice(networks, func(i, j int) bool { return networks[i].Before(networks[j]) })
+	var result []Network
+	for _, network := range networks {
+		if len(result) > 0 && result[len(result)-1].Contains(network) {
+			continue
+		}
+		result = append(result, network)
+		for len(result) > 1 {
+			supernet, ok := result[len(result)-2].join(result[len(result)-1])
+			if !ok {
+				break
+			}
+			result = append(result[:len(result)-2], supernet)
+		}
+	}
+	return result
+}
+
+// CountAddresses returns the number of addresses within networks that do not overlap
+func CountAddresses(networks []Network) *big.Int {
+	total := new(big.Int)
+	for _, network := range networks {
+		total.Add(total, new(big.Int).Lsh(big.NewInt(1), uint(network.Bits())-uint(network.ones)))
+	}
+	return total
+}
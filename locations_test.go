@@ -0,0 +1,43 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNetworksByLocation(t *testing.T) {
+	paris := &GeoLocation{CityName: "Paris", SubdivName: "Île-de-France", CountryISO: "FR"}
+	lyon := &GeoLocation{CityName: "Lyon", SubdivName: "Auvergne-Rhône-Alpes", CountryISO: "FR"}
+	saoPaulo := &GeoLocation{CityName: "São Paulo", SubdivName: "São Paulo", CountryISO: "BR"}
+	tree := NewTree(4)
+	tree.insert(&GeoPosition{Location: paris}, mustParseNetwork("192.0.2.0/25"))
+	tree.insert(&GeoPosition{Location: paris}, mustParseNetwork("192.0.2.128/26"))
+	tree.insert(&GeoPosition{Location: lyon}, mustParseNetwork("192.0.2.192/26"))
+	tree.insert(&GeoPosition{Location: saoPaulo}, mustParseNetwork("198.51.100.0/24"))
+	tree.insert(&GeoPosition{Location: lyon}, mustParseNetwork("198.51.100.64/26"))
+	tree.insert(&GeoPosition{Location: saoPaulo}, mustParseNetwork("2001:db8::/32"))
+
+	format := func(networks []Network) string {
+		var s []string
+		for _, network := range networks {
+			s = append(s, network.String())
+		}
+		return strings.Join(s, " ")
+	}
+	if result := format(AggregateNetworks(tree.NetworksByCountry("FR"))); result != "192.0.2.0/24 198.51.100.64/26" {
+		t.Error("FR aggregated to", result)
+	}
+	if result := format(AggregateNetworks(tree.NetworksByCity("FR", "Île-de-France", "Paris"))); result != "192.0.2.0/25 192.0.2.128/26" {
+		t.Error("Paris aggregated to", result)
+	}
+	brazil := AggregateNetworks(tree.NetworksBySubdivision("BR", "São Paulo"))
+	if result := format(brazil); result != "198.51.100.0/26 198.51.100.128/25 2001:db8::/32" {
+		t.Error("São Paulo aggregated to", result)
+	}
+	if count := CountAddresses(brazil[:2]); count.Int64() != 192 {
+		t.Error("São Paulo has", count, "IPv4 addresses")
+	}
+	if len(tree.NetworksByCountry("DE")) != 0 {
+		t.Error("DE should not have any networks")
+	}
+}
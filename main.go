@@ -1,14 +1,17 @@
 package main
 
 import (
-	"encoding/gob"
+	"flag"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
 	"runtime"
 	"runtime/pprof"
+	"sort"
+	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
 )
 
@@ -19,96 +22,186 @@ const apnicPath = basePath + "delegated-apnic-extended-latest"     // http://ftp
 const afrinicPath = basePath + "delegated-afrinic-extended-latest" // http://ftp.apnic.net/stats/afrinic/
 const lacnicPath = basePath + "delegated-lacnic-extended-latest"   // https://ftp.lacnic.net/pub/stats/lacnic/
 
-func main() {
-	profileStart()
-	defer pprof.StopCPUProfile()
-
-	t := time.Now()
-	tree := NewTree(128)
-	catchBreakSequenceForDebug(tree)
-	counters = startCounting()
+// exit codes shared by every command
+const (
+	exitFailure     = 1   // input data could not be read or output could not be written
+	exitUsage       = 2   // the command line was invalid, which is also what the flag package uses
+	exitIssues      = 3   // check-overrides found overrides that can never take effect
+	exitNotFound    = 4   // lookup found no position for at least one address
+	exitInterrupted = 130 // the process received SIGINT or SIGTERM while profiling
+)
 
-	ingestGeoliteData(tree)
+type command struct {
+	run     func(args []string)
+	summary string
+}
 
-	counters.ticker.Stop()
+var commands = map[string]command{
+	"build":           {buildCommand, "ingest the input data and save the tree"},
+	"lookup":          {lookupCommand, "print the position of one or more addresses"},
+	"dump":            {dumpCommand, "export the tree as json, csv or mmdb"},
+	"enrich":          {enrichCommand, "append positions to the addresses in log lines"},
+	"stats":           {statsCommand, "print statistics about the tree"},
+	"serve":           {serveCommand, "answer lookups over http"},
+	"export-acl":      {exportACLCommand, "export per-country access control lists"},
+	"check-overrides": {checkOverridesCommand, "validate an overrides file against the tree"},
+	"update":          {updateCommand, "download and verify new input data"},
+}
 
-	fmt.Println("finished in", time.Since(t))
+func main() {
+	cpuProfile := flag.String("cpuprofile", "", "write a CPU profile to the file")
+	memProfile := flag.String("memprofile", "", "write a heap profile to the file when the command finishes")
+	flag.Usage = usage
+	flag.Parse()
+	cmd, found := commands[flag.Arg(0)]
+	if !found {
+		if flag.NArg() > 0 {
+			fmt.Fprintf(os.Stderr, "unknown command '%v'\n", flag.Arg(0))
+		}
+		usage()
+		os.Exit(exitUsage)
+	}
+	startProfiling(*cpuProfile, *memProfile)
+	cmd.run(flag.Args()[1:])
+	exit(0)
+}
 
-	runtime.GC()
-	heapProf, err := os.Create("heap.prof")
-	if err != nil {
-		log.Fatal(err)
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: networktree [--cpuprofile file] [--memprofile file] command [arguments]\n\ncommands:\n")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-16v %v\n", name, commands[name].summary)
 	}
-	defer heapProf.Close()
-	pprof.WriteHeapProfile(heapProf)
+	fmt.Fprintf(os.Stderr, "\nflags:\n")
+	flag.PrintDefaults()
+}
 
-	os.Exit(1)
+var profiling struct {
+	cpu     *os.File
+	memPath string
+}
 
-	f, err := os.Create("output.gob")
-	f.Truncate(0)
-	f.Seek(0, 0)
-	if err != nil {
-		log.Fatal(err)
+// startProfiling enables the requested profiles, which are written by exit or when the process is interrupted
+func startProfiling(cpuPath, memPath string) {
+	if cpuPath != "" {
+		f, err := os.Create(cpuPath)
+		if err != nil {
+			fatalf("unable to create cpu profile because: %v", err)
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			fatalf("unable to start cpu profile because: %v", err)
+		}
+		profiling.cpu = f
+	}
+	profiling.memPath = memPath
+	if cpuPath != "" || memPath != "" {
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-c
+			exit(exitInterrupted)
+		}()
 	}
-	defer f.Close()
-	gob.NewEncoder(f).Encode(tree)
-
-	// f.Truncate(0)
-	// f.Seek(0, 0)
-	// f.WriteString(tree.JSON())
 }
 
-func profileStart() {
-	cpuProf, err := os.Create("cpu.prof")
-	if err != nil {
-		log.Fatal(err)
+func stopProfiling() {
+	if profiling.cpu != nil {
+		pprof.StopCPUProfile()
+		profiling.cpu.Close()
+		profiling.cpu = nil
 	}
-	pprof.StartCPUProfile(cpuProf)
-}
-
-func catchBreakSequenceForDebug(tree *Tree) {
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
-	go func() {
-		for range c {
-			pprof.StopCPUProfile()
-			runtime.GC()
-			heapProf, err := os.Create("heap.prof")
-			if err != nil {
-				log.Fatal(err)
-			}
-			pprof.WriteHeapProfile(heapProf)
-			f, _ := os.Create("output.json")
-			f.Truncate(0)
-			f.Seek(0, 0)
-			f.WriteString(tree.JSON())
-			os.Exit(1)
+	if profiling.memPath != "" {
+		runtime.GC()
+		f, err := os.Create(profiling.memPath)
+		if err != nil {
+			log.Printf("unable to create heap profile because: %v", err)
+			return
+		}
+		defer f.Close()
+		if err := pprof.WriteHeapProfile(f); err != nil {
+			log.Printf("unable to write heap profile because: %v", err)
 		}
-	}()
+		profiling.memPath = ""
+	}
 }
 
-type tickerCounters struct {
-	rate         uint64
-	parentRate   uint64
-	noParentRate uint64
-	ticker       *time.Ticker
+// exit writes any profiles before terminating with the code
+func exit(code int) {
+	stopProfiling()
+	os.Exit(code)
 }
 
-var counters tickerCounters
+// fatalf logs the message and exits with exitFailure once any profiles are written
+func fatalf(format string, v ...interface{}) {
+	log.Printf(format, v...)
+	exit(exitFailure)
+}
 
-func startCounting() tickerCounters {
-	counters = tickerCounters{
-		ticker: time.NewTicker(time.Second),
+// parseFlags parses the arguments of a command and exits through exit when they are invalid
+func parseFlags(flags *flag.FlagSet, args []string) {
+	if err := flags.Parse(args); err == flag.ErrHelp {
+		exit(0)
+	} else if err != nil {
+		exit(exitUsage)
 	}
-	go func() {
-		var total uint64
-		for range counters.ticker.C {
-			old := atomic.SwapUint64(&counters.rate, 0)
-			total += old
-			fmt.Printf("%v count/sec  %v total  %v insertWithParent()  %v insertWithoutParent()\n",
-				old, total, atomic.SwapUint64(&counters.parentRate, 0),
-				atomic.SwapUint64(&counters.noParentRate, 0))
+}
+
+// fileProgress counts the records read from a single input file
+type fileProgress struct {
+	name    string
+	records uint64
+}
+
+// buildTree ingests every data source into a compacted Tree
+func buildTree() *Tree {
+	tree := NewTree(128)
+	progress.start()
+	ingestGeoliteData(tree)
+	ingestRIRData(tree)
+	tree.Compact()
+	progress.stop()
+	tree.Metadata.BuildTime = time.Now().UTC()
+	return tree
+}
+
+type progressReporter struct {
+	mtx    sync.Mutex
+	files  []*fileProgress
+	ticker *time.Ticker
+}
+
+var progress progressReporter
+
+func (p *progressReporter) track(name string) *fileProgress {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	f := &fileProgress{name: name}
+	p.files = append(p.files, f)
+	return f
+}
+
+func (p *progressReporter) start() {
+	p.ticker = time.NewTicker(time.Second)
+	go func(ticker *time.Ticker) {
+		previous := map[*fileProgress]uint64{}
+		for range ticker.C {
+			p.mtx.Lock()
+			for _, f := range p.files {
+				total := atomic.LoadUint64(&f.records)
+				fmt.Fprintf(os.Stderr, "%v: %v records/sec  %v total\n", f.name, total-previous[f], total)
+				previous[f] = total
+			}
+			p.mtx.Unlock()
 		}
-	}()
-	return counters
+	}(p.ticker)
+}
+
+func (p *progressReporter) stop() {
+	if p.ticker != nil {
+		p.ticker.Stop()
+	}
 }
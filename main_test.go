@@ -2,59 +2,77 @@ package main
 
 import (
 	"net"
+	"os"
+	"path"
 	"reflect"
 	"testing"
-
-	"github.com/demskie/subnetmath"
 )
 
 var benchTree32 *Tree
 
-func createBenchTree32() *Tree {
+// skipWithoutGeolite skips benchmarks of the full GeoLite dataset, which is not part of the repository
+func skipWithoutGeolite(b *testing.B) {
+	for _, inputPath := range []string{cityLocationsPath, cityBlocksV4Path, cityBlocksV6Path} {
+		if _, err := os.Stat(path.Join(os.Getenv("GOPATH"), inputPath)); err != nil {
+			b.Skip("the GeoLite dataset is missing:", err)
+		}
+	}
+}
+
+func createBenchTree32(b *testing.B) *Tree {
+	skipWithoutGeolite(b)
 	if benchTree32 == nil {
-		ticker.Stop()
 		benchTree32 = NewTree(32)
-		ingest(benchTree32, arinPath)
-		ingest(benchTree32, ripePath)
+		ingestGeoliteData(benchTree32)
 	}
 	return benchTree32
 }
 
 func TestClosestSupernet(t *testing.T) {
-	tree := createBenchTree32()
-	nodes := []*node{
-		&node{network: subnetmath.ParseNetworkCIDR("3.0.0.0/8")},
-		&node{network: subnetmath.ParseNetworkCIDR("4.0.0.0/6")},
-		&node{network: subnetmath.ParseNetworkCIDR("8.0.0.0/5")},
-		&node{network: subnetmath.ParseNetworkCIDR("16.0.0.0/4")},
-		&node{network: subnetmath.ParseNetworkCIDR("32.0.0.0/3")},
-		&node{network: subnetmath.ParseNetworkCIDR("64.0.0.0/2")},
-		&node{network: subnetmath.ParseNetworkCIDR("128.0.0.0/2")},
-		&node{network: subnetmath.ParseNetworkCIDR("192.0.0.0/4")},
-		&node{network: subnetmath.ParseNetworkCIDR("208.0.0.0/5")},
-		&node{network: subnetmath.ParseNetworkCIDR("216.0.0.0/8")},
-		&node{network: subnetmath.ParseNetworkCIDR("217.147.184.0/21")},
+	tree := NewTree(32)
+	nodes := []*Node{
+		&Node{Network: mustParseNetwork("3.0.0.0/8")},
+		&Node{Network: mustParseNetwork("4.0.0.0/6")},
+		&Node{Network: mustParseNetwork("8.0.0.0/5")},
+		&Node{Network: mustParseNetwork("16.0.0.0/4")},
+		&Node{Network: mustParseNetwork("32.0.0.0/3")},
+		&Node{Network: mustParseNetwork("64.0.0.0/2")},
+		&Node{Network: mustParseNetwork("128.0.0.0/2")},
+		&Node{Network: mustParseNetwork("192.0.0.0/4")},
+		&Node{Network: mustParseNetwork("208.0.0.0/5")},
+		&Node{Network: mustParseNetwork("216.0.0.0/8")},
+		&Node{Network: mustParseNetwork("217.147.184.0/21")},
 	}
-	result := tree.findClosestSupernet(subnetmath.ParseNetworkCIDR("204.29.8.0/23"), nodes)
-	if !reflect.DeepEqual(result.network, subnetmath.ParseNetworkCIDR("192.0.0.0/4")) {
-		t.Error(result.network, "does not equal", subnetmath.ParseNetworkCIDR("192.0.0.0/4"))
+	result := tree.findClosestSupernet(mustParseNetwork("204.29.8.0/23"), nodes)
+	if !reflect.DeepEqual(result.Network, mustParseNetwork("192.0.0.0/4")) {
+		t.Error(result.Network, "does not equal", mustParseNetwork("192.0.0.0/4"))
 	}
 }
 
 func BenchmarkFindNetwork(b *testing.B) {
-	tree := createBenchTree32()
+	tree := createBenchTree32(b)
+	addr := net.ParseIP("185.48.252.0")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		lookupByChildren(tree, addr)
+	}
+}
+
+func BenchmarkFindNetworkTrie(b *testing.B) {
+	tree := createBenchTree32(b)
 	addr := net.ParseIP("185.48.252.0")
+	tree.lookupTrie()
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		tree.findNetwork(addr, benchTree32.roots)
+		tree.Lookup(addr)
 	}
 }
 
 func BenchmarkFindClosestSupernet(b *testing.B) {
-	tree := createBenchTree32()
-	network := subnetmath.ParseNetworkCIDR("185.48.252.0/22")
+	tree := createBenchTree32(b)
+	network := mustParseNetwork("185.48.252.0/22")
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		tree.findClosestSupernet(network, benchTree32.roots)
+		tree.findClosestSupernet(network, benchTree32.Roots)
 	}
 }
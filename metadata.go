@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"time"
+)
+
+// formatVersion is increased whenever the serialized form of a Tree changes
+const formatVersion = 1
+
+// Metadata identifies the data that a Tree was built from
+type Metadata struct {
+	FormatVersion int              `json:"formatVersion"`
+	BuildTime     time.Time        `json:"buildTime"`
+	Sources       []SourceMetadata `json:"sources"`
+}
+
+// SourceMetadata describes one input file
+type SourceMetadata struct {
+	Name     string `json:"name"`
+	Serial   string `json:"serial,omitempty"` // YYYYMMDD when the file carries one
+	Checksum string `json:"checksum"`         // sha256 of the file contents
+	Records  uint64 `json:"records"`
+}
+
+// addSources records input files in the Metadata of the tree
+func (tree *Tree) addSources(sources ...SourceMetadata) {
+	tree.mtx.Lock()
+	tree.Metadata.Sources = append(tree.Metadata.Sources, sources...)
+	tree.mtx.Unlock()
+}
+
+// inputFile hashes an input file while it is read
+type inputFile struct {
+	io.Reader
+	file   *os.File
+	digest hash.Hash
+}
+
+func openInput(inputPath string) (*inputFile, error) {
+	gopath, _ := os.LookupEnv("GOPATH")
+	f, err := os.Open(path.Join(gopath, inputPath))
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.New()
+	return &inputFile{Reader: io.TeeReader(f, digest), file: f, digest: digest}, nil
+}
+
+// close releases the file and describes everything that was read from it
+func (f *inputFile) close(records uint64, serial time.Time) SourceMetadata {
+	f.file.Close()
+	source := SourceMetadata{
+		Name:     path.Base(f.file.Name()),
+		Checksum: hex.EncodeToString(f.digest.Sum(nil)),
+		Records:  records,
+	}
+	if !serial.IsZero() {
+		source.Serial = serial.Format("20060102")
+	}
+	return source
+}
+
+// treeSnapshot is the gob representation of a Tree, which cannot be encoded directly
+// because every Node points back at its parent
+type treeSnapshot struct {
+	Metadata  Metadata
+	Precision int
+	Locations []GeoLocation
+	Positions []snapshotPosition
+	Nodes     []snapshotNode // parents always precede their children
+	Registry  *Tree
+	ASNs      []ASNRecord
+	Serials   map[Source]time.Time
+}
+
+type snapshotPosition struct {
+	Latitude       float64
+	Longitude      float64
+	Location       int32 // index into Locations, -1 when nil
+	AccuracyRadius uint16
+	Source         Source
+	Allocation     *Allocation
+}
+
+type snapshotNode struct {
+	Network  Network
+	Position int32 // index into Positions, -1 when nil
+	Parent   int32 // index into Nodes, -1 for roots
+}
+
+// GobEncode writes the Tree together with its Metadata
+func (tree *Tree) GobEncode() ([]byte, error) {
+	snapshot := treeSnapshot{
+		Metadata:  tree.Metadata,
+		Precision: tree.Precision,
+		Registry:  tree.Registry,
+		ASNs:      tree.ASNs,
+		Serials:   tree.Serials,
+	}
+	locations := map[*GeoLocation]int32{nil: -1}
+	positions := map[*GeoPosition]int32{nil: -1}
+	var walk func(nodes []*Node, parent int32)
+	walk = func(nodes []*Node, parent int32) {
+		for _, n := range nodes {
+			if _, exists := positions[n.GeoPosition]; !exists {
+				if _, exists := locations[n.GeoPosition.Location]; !exists {
+					locations[n.GeoPosition.Location] = int32(len(snapshot.Locations))
+					snapshot.Locations = append(snapshot.Locations, *n.GeoPosition.Location)
+				}
+				positions[n.GeoPosition] = int32(len(snapshot.Positions))
+				snapshot.Positions = append(snapshot.Positions, snapshotPosition{
+					Latitude:       n.GeoPosition.Latitude,
+					Longitude:      n.GeoPosition.Longitude,
+					Location:       locations[n.GeoPosition.Location],
+					AccuracyRadius: n.GeoPosition.AccuracyRadius,
+					Source:         n.GeoPosition.Source,
+					Allocation:     n.GeoPosition.Allocation,
+				})
+			}
+			snapshot.Nodes = append(snapshot.Nodes, snapshotNode{n.Network, positions[n.GeoPosition], parent})
+			walk(n.Children, int32(len(snapshot.Nodes)-1))
+		}
+	}
+	walk(tree.Roots, -1)
+	walk(tree.RootsV6, -1)
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(&snapshot)
+	return buf.Bytes(), err
+}
+
+// GobDecode restores a Tree written by GobEncode
+func (tree *Tree) GobDecode(b []byte) error {
+	var snapshot treeSnapshot
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&snapshot); err != nil {
+		return err
+	}
+	if snapshot.Metadata.FormatVersion != formatVersion {
+		return fmt.Errorf("format version %v is not supported", snapshot.Metadata.FormatVersion)
+	}
+	*tree = *NewTree(snapshot.Precision)
+	tree.Metadata = snapshot.Metadata
+	tree.Registry = snapshot.Registry
+	tree.ASNs = snapshot.ASNs
+	tree.Serials = snapshot.Serials
+	positions := make([]*GeoPosition, len(snapshot.Positions))
+	for i, p := range snapshot.Positions {
+		positions[i] = &GeoPosition{
+			Latitude:       p.Latitude,
+			Longitude:      p.Longitude,
+			AccuracyRadius: p.AccuracyRadius,
+			Source:         p.Source,
+			Allocation:     p.Allocation,
+		}
+		if p.Location >= 0 {
+			positions[i].Location = &snapshot.Locations[p.Location]
+		}
+	}
+	nodes := make([]*Node, len(snapshot.Nodes))
+	for i, s := range snapshot.Nodes {
+		nodes[i] = &Node{Network: s.Network}
+		if s.Position >= 0 {
+			nodes[i].GeoPosition = positions[s.Position]
+		}
+		if s.Parent < 0 && !s.Network.IsV6() {
+			tree.Roots = append(tree.Roots, nodes[i])
+		} else if s.Parent < 0 {
+			tree.RootsV6 = append(tree.RootsV6, nodes[i])
+		} else {
+			nodes[i].Parent = nodes[s.Parent]
+			nodes[s.Parent].Children = append(nodes[s.Parent].Children, nodes[i])
+		}
+	}
+	tree.Size = len(nodes)
+	return nil
+}
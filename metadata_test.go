@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+)
+
+func buildFixtureTree(t *testing.T) *Tree {
+	writeGeoliteFixtures(t, []string{
+		"10.0.0.0/16,1,,,0,0,,48.85,2.35,20",
+		"10.1.0.0/16,,3,,0,0,,,,",
+	}, []string{"2001:db8::/32,2,,,0,0,,-23.5,-46.6,100"})
+	writeDelegatedFixtures(t, map[string]string{
+		afrinicPath: "2|afrinic|20190107|2|00000000|20190107|00000\n" +
+			"afrinic|*|asn|*|1|summary\n" +
+			"afrinic|*|ipv4|*|1|summary\n" +
+			"afrinic|*|ipv6|*|0|summary\n" +
+			"afrinic|ZA|asn|1228|1|19910301|allocated|F36B9F4B\n" +
+			"afrinic|ZA|ipv4|41.0.0.0|65536|20070409|allocated|F36B9F4B\n",
+	})
+	tree := NewTree(16)
+	ingestGeoliteData(tree)
+	ingestRIRData(tree)
+	tree.Compact()
+	return tree
+}
+
+func TestMetadataSources(t *testing.T) {
+	tree := buildFixtureTree(t)
+	if tree.Metadata.FormatVersion != formatVersion {
+		t.Errorf("format version was %v", tree.Metadata.FormatVersion)
+	}
+	records := map[string]uint64{
+		path.Base(cityLocationsPath): 4,
+		path.Base(cityBlocksV4Path):  2,
+		path.Base(cityBlocksV6Path):  1,
+		path.Base(afrinicPath):       2,
+	}
+	if len(tree.Metadata.Sources) != len(records) {
+		t.Fatalf("unexpected sources: %+v", tree.Metadata.Sources)
+	}
+	gopath, _ := os.LookupEnv("GOPATH")
+	for _, source := range tree.Metadata.Sources {
+		contents, _ := os.ReadFile(path.Join(gopath, basePath, source.Name))
+		checksum := sha256.Sum256(contents)
+		if source.Checksum != hex.EncodeToString(checksum[:]) {
+			t.Errorf("%v has the wrong checksum", source.Name)
+		}
+		if source.Records != records[source.Name] {
+			t.Errorf("%v lists %v records instead of %v", source.Name, source.Records, records[source.Name])
+		}
+		if serial := source.Serial; (source.Name == path.Base(afrinicPath)) != (serial == "20190107") {
+			t.Errorf("%v has the serial %q", source.Name, serial)
+		}
+	}
+}
+
+func TestGobRoundTrip(t *testing.T) {
+	tree := buildFixtureTree(t)
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(tree); err != nil {
+		t.Fatal(err)
+	}
+	decoded := &Tree{}
+	if err := gob.NewDecoder(&buf).Decode(decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Size != tree.Size || decoded.Precision != tree.Precision || len(decoded.Metadata.Sources) != 4 {
+		t.Errorf("decoded tree differs: %v nodes with precision %v and %v sources",
+			decoded.Size, decoded.Precision, len(decoded.Metadata.Sources))
+	}
+	for _, address := range []string{"10.0.0.1", "10.1.0.1", "41.0.0.1", "2001:db8::1", "192.0.2.1"} {
+		n, precision := tree.LookupLayered(net.ParseIP(address))
+		m, decodedPrecision := decoded.LookupLayered(net.ParseIP(address))
+		if precision != decodedPrecision || (n == nil) != (m == nil) {
+			t.Errorf("%v resolved with %v after decoding instead of %v", address, decodedPrecision, precision)
+		} else if n != nil && (n.Network != m.Network || n.GeoPosition.Latitude != m.GeoPosition.Latitude ||
+			n.GeoPosition.Source != m.GeoPosition.Source || *n.GeoPosition.Location != *m.GeoPosition.Location) {
+			t.Errorf("%v resolved to %v after decoding instead of %v", address, m.Network, n.Network)
+		} else if n != nil && n.GeoPosition.Allocation != nil && *n.GeoPosition.Allocation != *m.GeoPosition.Allocation {
+			t.Errorf("%v lost its allocation after decoding", address)
+		}
+	}
+	if record, found := decoded.LookupASN(1228); !found || record.Allocation.OpaqueID != "F36B9F4B" {
+		t.Error("autonomous systems were not decoded")
+	}
+	checkFanOut(t, decoded, nil, decoded.Roots)
+
+	decoded.Metadata.FormatVersion = formatVersion + 1
+	buf.Reset()
+	gob.NewEncoder(&buf).Encode(decoded)
+	if err := gob.NewDecoder(&buf).Decode(&Tree{}); err == nil {
+		t.Error("an unsupported format version was decoded")
+	}
+}
+
+func TestMetadataExports(t *testing.T) {
+	tree := buildFixtureTree(t)
+	var exported struct {
+		Metadata Metadata          `json:"metadata"`
+		Networks []json.RawMessage `json:"networks"`
+	}
+	if err := json.Unmarshal([]byte(tree.JSON()), &exported); err != nil {
+		t.Fatal(err)
+	}
+	if len(exported.Metadata.Sources) != 4 || len(exported.Networks) == 0 {
+		t.Errorf("unexpected JSON export: %+v", exported)
+	}
+
+	recorder := httptest.NewRecorder()
+	newServeMux(tree).ServeHTTP(recorder, httptest.NewRequest("GET", "/status", nil))
+	var status struct {
+		FormatVersion int              `json:"formatVersion"`
+		Sources       []SourceMetadata `json:"sources"`
+		Networks      int              `json:"networks"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	if status.FormatVersion != formatVersion || len(status.Sources) != 4 || status.Networks != tree.Size {
+		t.Errorf("unexpected /status response: %v", recorder.Body.String())
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"math/bits"
+	"time"
+)
+
+// https://maxmind.github.io/MaxMind-DB/
+
+var mmdbMetadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// records are tagged while the search tree is built and resolved to offsets once its size is known
+const (
+	mmdbEmpty      = 0
+	mmdbNodeRecord = 1 << 62
+	mmdbDataRecord = 1 << 63
+)
+
+// mmdbMap is a map whose keys are written in order so that the output is reproducible
+type mmdbMap []mmdbPair
+
+type mmdbPair struct {
+	key   string
+	value interface{}
+}
+
+type mmdbWriter struct {
+	nodes   [][2]uint64
+	data    bytes.Buffer
+	offsets map[*GeoPosition]uint64
+}
+
+// writeMMDB writes the populated networks of the tree as an IPv6 MaxMind DB with 32 bit records laid out
+// like GeoLite2-City. IPv4 networks live under ::/96 and are also reachable through ::ffff:0:0/96 and 2002::/16.
+// A tree that was built from delegated files alone is written from its registry layer instead.
+// The metadata of the tree is carried in keys prefixed with networktree_.
+func writeMMDB(w io.Writer, tree *Tree) error {
+	databaseType, description := "GeoLite2-City", "GeoLite2 City exported by networktree"
+	layer := tree
+	if len(tree.Roots) == 0 && len(tree.RootsV6) == 0 && tree.Registry != nil {
+		databaseType, description = "networktree-RIR-Country", "RIR delegations exported by networktree"
+		layer = tree.Registry
+	}
+	m := &mmdbWriter{nodes: [][2]uint64{{mmdbEmpty, mmdbEmpty}}, offsets: map[*GeoPosition]uint64{}}
+	var walk func(nodes []*Node)
+	walk = func(nodes []*Node) {
+		for _, n := range nodes {
+			if n.GeoPosition != nil {
+				m.insert(mmdbNetwork(n.Network), m.record(n.GeoPosition))
+			}
+			walk(n.Children)
+		}
+	}
+	walk(layer.Roots)
+	walk(layer.RootsV6)
+	if ipv4 := m.find(mustParseNetwork("::/96")); ipv4&mmdbNodeRecord != 0 {
+		m.insert(mustParseNetwork("::ffff:0:0/96"), ipv4)
+		m.insert(mustParseNetwork("2002::/16"), ipv4)
+	}
+
+	nodeCount := uint64(len(m.nodes))
+	if nodeCount+16+uint64(m.data.Len()) > math.MaxUint32 {
+		return errors.New("the tree is too large for 32 bit records")
+	}
+	buf := make([]byte, 0, 8*nodeCount+16)
+	for _, node := range m.nodes {
+		for _, record := range node {
+			value := nodeCount
+			if record&mmdbNodeRecord != 0 {
+				value = record &^ mmdbNodeRecord
+			} else if record&mmdbDataRecord != 0 {
+				value = nodeCount + 16 + record&^mmdbDataRecord
+			}
+			buf = binary.BigEndian.AppendUint32(buf, uint32(value))
+		}
+	}
+	buf = append(buf, make([]byte, 16)...)
+	if _, err := w.Write(buf); err != nil {
+		return err
+	}
+	if _, err := m.data.WriteTo(w); err != nil {
+		return err
+	}
+
+	buildTime := tree.Metadata.BuildTime
+	if buildTime.IsZero() {
+		buildTime = time.Now()
+	}
+	sources := []interface{}{}
+	for _, source := range tree.Metadata.Sources {
+		sources = append(sources, mmdbMap{
+			{"checksum", source.Checksum},
+			{"name", source.Name},
+			{"records", source.Records},
+			{"serial", source.Serial},
+		})
+	}
+	var metadata bytes.Buffer
+	metadata.Write(mmdbMetadataMarker)
+	mmdbEncode(&metadata, mmdbMap{
+		{"binary_format_major_version", uint16(2)},
+		{"binary_format_minor_version", uint16(0)},
+		{"build_epoch", uint64(buildTime.Unix())},
+		{"database_type", databaseType},
+		{"description", mmdbMap{{"en", description}}},
+		{"ip_version", uint16(6)},
+		{"languages", []interface{}{"en"}},
+		{"networktree_format_version", uint32(tree.Metadata.FormatVersion)},
+		{"networktree_sources", sources},
+		{"node_count", uint32(nodeCount)},
+		{"record_size", uint16(32)},
+	})
+	_, err := metadata.WriteTo(w)
+	return err
+}
+
+// mmdbNetwork places IPv4 networks under ::/96
+func mmdbNetwork(network Network) Network {
+	if network.IsV6() {
+		return network
+	}
+	return Network{lo: network.hi >> 32, ones: 96 + network.ones, isV6: true}
+}
+
+// insert points every address in the network at the record. Networks must be inserted ahead of the
+// more specific networks inside them since the record replaces anything already below the network.
+func (m *mmdbWriter) insert(network Network, record uint64) {
+	if network.ones == 0 {
+		return
+	}
+	node := uint64(0)
+	for depth := uint8(0); depth < network.ones-1; depth++ {
+		child := m.nodes[node][network.bit(depth)]
+		if child&mmdbNodeRecord == 0 {
+			m.nodes = append(m.nodes, [2]uint64{child, child})
+			child = mmdbNodeRecord | uint64(len(m.nodes)-1)
+			m.nodes[node][network.bit(depth)] = child
+		}
+		node = child &^ mmdbNodeRecord
+	}
+	m.nodes[node][network.bit(network.ones-1)] = record
+}
+
+// find returns the record that the network resolves to without modifying the search tree
+func (m *mmdbWriter) find(network Network) uint64 {
+	var record uint64 = mmdbNodeRecord // the root node
+	for depth := uint8(0); depth < network.ones; depth++ {
+		if record&mmdbNodeRecord == 0 {
+			return record
+		}
+		record = m.nodes[record&^mmdbNodeRecord][network.bit(depth)]
+	}
+	return record
+}
+
+// record encodes the GeoPosition into the data section the first time it is seen
+func (m *mmdbWriter) record(geoPosition *GeoPosition) uint64 {
+	if offset, exists := m.offsets[geoPosition]; exists {
+		return mmdbDataRecord | offset
+	}
+	offset := uint64(m.data.Len())
+	m.offsets[geoPosition] = offset
+	location := mmdbMap{{"latitude", geoPosition.Latitude}, {"longitude", geoPosition.Longitude}}
+	if geoPosition.AccuracyRadius != 0 {
+		location = append(mmdbMap{{"accuracy_radius", geoPosition.AccuracyRadius}}, location...)
+	}
+	var value mmdbMap
+	if l := geoPosition.Location; l != nil {
+		if l.CityName != "" {
+			value = append(value, mmdbPair{"city", mmdbMap{{"names", mmdbMap{{"en", l.CityName}}}}})
+		}
+		if l.CountryISO != "" {
+			country := mmdbMap{{"iso_code", l.CountryISO}}
+			if l.IsPartOfEU {
+				country = append(mmdbMap{{"is_in_european_union", true}}, country...)
+			}
+			if l.CountryName != "" {
+				country = append(country, mmdbPair{"names", mmdbMap{{"en", l.CountryName}}})
+			}
+			value = append(value, mmdbPair{"country", country})
+		}
+		value = append(value, mmdbPair{"location", location})
+		if l.SubdivName != "" {
+			value = append(value, mmdbPair{"subdivisions", []interface{}{mmdbMap{{"names", mmdbMap{{"en", l.SubdivName}}}}}})
+		}
+	} else {
+		value = append(value, mmdbPair{"location", location})
+	}
+	mmdbEncode(&m.data, value)
+	return mmdbDataRecord | offset
+}
+
+func mmdbEncode(buf *bytes.Buffer, value interface{}) {
+	switch v := value.(type) {
+	case string:
+		mmdbControl(buf, 2, len(v))
+		buf.WriteString(v)
+	case float64:
+		mmdbControl(buf, 3, 8)
+		buf.Write(binary.BigEndian.AppendUint64(nil, math.Float64bits(v)))
+	case uint16:
+		mmdbUnsigned(buf, 5, uint64(v))
+	case uint32:
+		mmdbUnsigned(buf, 6, uint64(v))
+	case uint64:
+		mmdbUnsigned(buf, 9, v)
+	case bool:
+		size := 0
+		if v {
+			size = 1
+		}
+		mmdbControl(buf, 14, size)
+	case []interface{}:
+		mmdbControl(buf, 11, len(v))
+		for _, element := range v {
+			mmdbEncode(buf, element)
+		}
+	case mmdbMap:
+		mmdbControl(buf, 7, len(v))
+		for _, pair := range v {
+			mmdbEncode(buf, pair.key)
+			mmdbEncode(buf, pair.value)
+		}
+	default:
+		panic("mmdb cannot encode the value")
+	}
+}
+
+func mmdbUnsigned(buf *bytes.Buffer, dataType int, v uint64) {
+	size := (bits.Len64(v) + 7) / 8
+	mmdbControl(buf, dataType, size)
+	for i := size - 1; i >= 0; i-- {
+		buf.WriteByte(byte(v >> (8 * uint(i))))
+	}
+}
+
+// mmdbControl writes the control byte of a field followed by its extended type and size bytes
+func mmdbControl(buf *bytes.Buffer, dataType, size int) {
+	var control byte
+	if dataType <= 7 {
+		control = byte(dataType << 5)
+	}
+	var extra []byte
+	switch {
+	case size < 29:
+		control |= byte(size)
+	case size < 285:
+		control |= 29
+		extra = []byte{byte(size - 29)}
+	case size < 65821:
+		control |= 30
+		extra = []byte{byte((size - 285) >> 8), byte(size - 285)}
+	default:
+		control |= 31
+		extra = []byte{byte((size - 65821) >> 16), byte((size - 65821) >> 8), byte(size - 65821)}
+	}
+	buf.WriteByte(control)
+	if dataType > 7 {
+		buf.WriteByte(byte(dataType - 7))
+	}
+	buf.Write(extra)
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"net"
+	"testing"
+)
+
+// mmdbReader is just enough of a MaxMind DB reader to check what writeMMDB produces
+type mmdbReader struct {
+	t         *testing.T
+	tree      []byte
+	data      []byte
+	nodeCount uint64
+	metadata  map[string]interface{}
+}
+
+func newMMDBReader(t *testing.T, b []byte) *mmdbReader {
+	marker := bytes.LastIndex(b, mmdbMetadataMarker)
+	if marker < 0 {
+		t.Fatal("the metadata marker is missing")
+	}
+	r := &mmdbReader{t: t}
+	metadata, _ := r.decode(b, marker+len(mmdbMetadataMarker))
+	r.metadata = metadata.(map[string]interface{})
+	r.nodeCount = r.metadata["node_count"].(uint64)
+	if r.metadata["record_size"].(uint64) != 32 || r.metadata["ip_version"].(uint64) != 6 {
+		t.Fatalf("unexpected metadata: %v", r.metadata)
+	}
+	r.tree = b[:8*r.nodeCount]
+	if !bytes.Equal(b[8*r.nodeCount:8*r.nodeCount+16], make([]byte, 16)) {
+		t.Fatal("the data section separator is missing")
+	}
+	r.data = b[8*r.nodeCount+16 : marker]
+	return r
+}
+
+func (r *mmdbReader) lookup(address net.IP) map[string]interface{} {
+	ip := address.To16()
+	if v4 := address.To4(); v4 != nil {
+		ip = append(make(net.IP, 12), v4...)
+	}
+	node := uint64(0)
+	for i := 0; i < 128 && node < r.nodeCount; i++ {
+		bit := ip[i/8] >> (7 - uint(i%8)) & 1
+		node = uint64(binary.BigEndian.Uint32(r.tree[8*node+4*uint64(bit):]))
+	}
+	if node <= r.nodeCount {
+		return nil
+	}
+	value, _ := r.decode(r.data, int(node-r.nodeCount-16))
+	return value.(map[string]interface{})
+}
+
+func (r *mmdbReader) decode(b []byte, offset int) (interface{}, int) {
+	control := b[offset]
+	offset++
+	dataType := int(control >> 5)
+	if dataType == 0 {
+		dataType = 7 + int(b[offset])
+		offset++
+	}
+	size := int(control & 0x1f)
+	switch size {
+	case 29:
+		size = 29 + int(b[offset])
+		offset++
+	case 30:
+		size = 285 + (int(b[offset])<<8 | int(b[offset+1]))
+		offset += 2
+	case 31:
+		size = 65821 + (int(b[offset])<<16 | int(b[offset+1])<<8 | int(b[offset+2]))
+		offset += 3
+	}
+	switch dataType {
+	case 2:
+		return string(b[offset : offset+size]), offset + size
+	case 3:
+		return math.Float64frombits(binary.BigEndian.Uint64(b[offset:])), offset + 8
+	case 5, 6, 9:
+		var v uint64
+		for _, c := range b[offset : offset+size] {
+			v = v<<8 | uint64(c)
+		}
+		return v, offset + size
+	case 7:
+		m := map[string]interface{}{}
+		for i := 0; i < size; i++ {
+			var key, value interface{}
+			key, offset = r.decode(b, offset)
+			value, offset = r.decode(b, offset)
+			m[key.(string)] = value
+		}
+		return m, offset
+	case 11:
+		a := make([]interface{}, size)
+		for i := range a {
+			a[i], offset = r.decode(b, offset)
+		}
+		return a, offset
+	case 14:
+		return size == 1, offset
+	}
+	r.t.Fatalf("unexpected data type %v", dataType)
+	return nil, 0
+}
+
+func TestWriteMMDB(t *testing.T) {
+	paris := &GeoPosition{Latitude: 48.85, Longitude: 2.35, AccuracyRadius: 20, Source: SourceGeoLite,
+		Location: &GeoLocation{CityName: "Paris", SubdivName: "Île-de-France", CountryISO: "FR", CountryName: "France", IsPartOfEU: true}}
+	germany := &GeoPosition{Latitude: 51, Longitude: 9, Source: SourceGeoLite,
+		Location: &GeoLocation{CountryISO: "DE", CountryName: "Germany", IsPartOfEU: true}}
+	brazil := &GeoPosition{Latitude: -23.5, Longitude: -46.6, AccuracyRadius: 1000, Source: SourceGeoLite,
+		Location: &GeoLocation{CityName: "São Paulo", CountryISO: "BR", CountryName: "Brazil"}}
+	tree := NewTree(16)
+	tree.insert(paris, mustParseNetwork("45.0.0.0/8"))
+	tree.insert(germany, mustParseNetwork("45.1.0.0/16"), mustParseNetwork("45.2.0.128/25"))
+	tree.insert(brazil, mustParseNetwork("2a00::/12"), mustParseNetwork("1.2.3.4/32"))
+	tree.addSources(SourceMetadata{Name: "GeoLite2-City-Blocks-IPv4.csv", Checksum: "abc", Records: 3},
+		SourceMetadata{Name: "delegated-afrinic-extended-latest", Serial: "20190107", Checksum: "def", Records: 2})
+	var buf bytes.Buffer
+	if err := writeMMDB(&buf, tree); err != nil {
+		t.Fatal(err)
+	}
+	r := newMMDBReader(t, buf.Bytes())
+	if r.metadata["database_type"] != "GeoLite2-City" || r.metadata["binary_format_major_version"].(uint64) != 2 ||
+		r.metadata["networktree_format_version"] != uint64(formatVersion) {
+		t.Errorf("unexpected metadata: %v", r.metadata)
+	}
+	if sources := r.metadata["networktree_sources"].([]interface{}); len(sources) != 2 ||
+		sources[1].(map[string]interface{})["serial"] != "20190107" || sources[1].(map[string]interface{})["checksum"] != "def" ||
+		sources[0].(map[string]interface{})["records"] != uint64(3) {
+		t.Errorf("unexpected sources: %v", sources)
+	}
+
+	country := func(record map[string]interface{}) string {
+		if record == nil {
+			return ""
+		}
+		return record["country"].(map[string]interface{})["iso_code"].(string)
+	}
+	for _, test := range []struct {
+		address string
+		country string
+	}{
+		{"45.0.0.1", "FR"},
+		{"45.1.255.255", "DE"},
+		{"45.2.0.127", "FR"},
+		{"45.2.0.128", "DE"},
+		{"45.255.255.255", "FR"},
+		{"44.255.255.255", ""},
+		{"46.0.0.0", ""},
+		{"1.2.3.4", "BR"},
+		{"1.2.3.5", ""},
+		{"::ffff:45.1.0.1", "DE"},
+		{"2002:2d02:0080::1", "DE"},
+		{"2a0f:ffff::1", "BR"},
+		{"2a10::1", ""},
+		{"::1", ""},
+	} {
+		if c := country(r.lookup(net.ParseIP(test.address))); c != test.country {
+			t.Errorf("%v resolved to %q instead of %q", test.address, c, test.country)
+		}
+	}
+
+	record := r.lookup(net.ParseIP("45.0.0.1"))
+	location := record["location"].(map[string]interface{})
+	if location["latitude"] != 48.85 || location["longitude"] != 2.35 || location["accuracy_radius"] != uint64(20) {
+		t.Errorf("unexpected location: %v", location)
+	}
+	if record["city"].(map[string]interface{})["names"].(map[string]interface{})["en"] != "Paris" ||
+		record["country"].(map[string]interface{})["is_in_european_union"] != true ||
+		record["subdivisions"].([]interface{})[0].(map[string]interface{})["names"].(map[string]interface{})["en"] != "Île-de-France" {
+		t.Errorf("unexpected record: %v", record)
+	}
+	if _, found := r.lookup(net.ParseIP("45.1.0.1"))["city"]; found {
+		t.Error("networks without a city should not have a city")
+	}
+	if size := len(encodedRecord(paris)) + len(encodedRecord(germany)) + len(encodedRecord(brazil)); len(r.data) != size {
+		t.Errorf("every position should be written once but the data section has %v bytes instead of %v", len(r.data), size)
+	}
+}
+
+func TestWriteMMDBRegistryOnly(t *testing.T) {
+	tree := NewTree(16)
+	tree.Registry = NewTree(16)
+	tree.Registry.insert(&GeoPosition{Latitude: -29, Longitude: 24, Source: SourceAFRINIC,
+		Location: &GeoLocation{CountryISO: "ZA"}}, mustParseNetwork("41.0.0.0/16"))
+	var buf bytes.Buffer
+	if err := writeMMDB(&buf, tree); err != nil {
+		t.Fatal(err)
+	}
+	r := newMMDBReader(t, buf.Bytes())
+	if r.metadata["database_type"] != "networktree-RIR-Country" {
+		t.Errorf("unexpected database type %v", r.metadata["database_type"])
+	}
+	if record := r.lookup(net.ParseIP("41.0.1.1")); record == nil || record["country"].(map[string]interface{})["iso_code"] != "ZA" {
+		t.Errorf("the registry network was not written: %v", record)
+	}
+}
+
+func encodedRecord(geoPosition *GeoPosition) []byte {
+	m := &mmdbWriter{offsets: map[*GeoPosition]uint64{}}
+	m.record(geoPosition)
+	return m.data.Bytes()
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/bits"
+	"net"
+	"strconv"
+)
+
+// Network is a fixed-width representation of an IPv4 or IPv6 CIDR. Addresses are
+// stored left aligned so that IPv4 occupies the top 32 bits of hi.
+type Network struct {
+	hi, lo uint64
+	ones   uint8
+	isV6   bool
+}
+
+// ParseNetwork parses a CIDR string such as "192.0.2.0/24" into a Network
+func ParseNetwork(s string) (Network, error) {
+	_, ipNet, err := net.ParseCIDR(s)
+	if err != nil {
+		return Network{}, err
+	}
+	network, ok := NetworkFromIPNet(ipNet)
+	if !ok {
+		return Network{}, errors.New("invalid network " + s)
+	}
+	return network, nil
+}
+
+// mustParseNetwork is ParseNetwork for networks that are fixed in code
+func mustParseNetwork(s string) Network {
+	network, err := ParseNetwork(s)
+	if err != nil {
+		panic(err)
+	}
+	return network
+}
+
+// NetworkFromIPNet converts a *net.IPNet into a Network
+func NetworkFromIPNet(ipNet *net.IPNet) (Network, bool) {
+	network, ok := NetworkFromIP(ipNet.IP)
+	ones, maskBits := ipNet.Mask.Size()
+	if !ok || maskBits == 0 {
+		return Network{}, false
+	}
+	if !network.isV6 && maskBits == 8*net.IPv6len {
+		ones -= 96
+	} else if network.isV6 && maskBits != 8*net.IPv6len {
+		return Network{}, false
+	}
+	if ones < 0 {
+		return Network{}, false
+	}
+	return network.masked(uint8(ones)), true
+}
+
+// NetworkFromIP converts an address into a host Network (/32 or /128)
+func NetworkFromIP(address net.IP) (Network, bool) {
+	if ip := address.To4(); ip != nil {
+		return Network{hi: uint64(binary.BigEndian.Uint32(ip)) << 32, ones: 32}, true
+	}
+	if ip := address.To16(); ip != nil {
+		return Network{
+			hi:   binary.BigEndian.Uint64(ip[:8]),
+			lo:   binary.BigEndian.Uint64(ip[8:]),
+			ones: 128,
+			isV6: true,
+		}, true
+	}
+	return Network{}, false
+}
+
+// IP returns the first address of the Network
+func (n Network) IP() net.IP {
+	if !n.isV6 {
+		ip := make(net.IP, net.IPv4len)
+		binary.BigEndian.PutUint32(ip, uint32(n.hi>>32))
+		return ip
+	}
+	ip := make(net.IP, net.IPv6len)
+	binary.BigEndian.PutUint64(ip[:8], n.hi)
+	binary.BigEndian.PutUint64(ip[8:], n.lo)
+	return ip
+}
+
+// IPNet converts the Network back into a *net.IPNet
+func (n Network) IPNet() *net.IPNet {
+	return &net.IPNet{IP: n.IP(), Mask: net.CIDRMask(int(n.ones), int(n.Bits()))}
+}
+
+// Ones returns the prefix length of the Network
+func (n Network) Ones() int {
+	return int(n.ones)
+}
+
+// Bits returns 32 for IPv4 and 128 for IPv6 networks
+func (n Network) Bits() uint8 {
+	if n.isV6 {
+		return 128
+	}
+	return 32
+}
+
+// IsV6 reports whether the Network is an IPv6 network
+func (n Network) IsV6() bool {
+	return n.isV6
+}
+
+func (n Network) String() string {
+	return n.IP().String() + "/" + strconv.Itoa(int(n.ones))
+}
+
+// Contains reports whether other is equal to or a subnet of the Network
+func (n Network) Contains(other Network) bool {
+	return n.ones <= other.ones && n.containsAddress(other)
+}
+
+// ContainsIP reports whether the address falls within the Network
+func (n Network) ContainsIP(address net.IP) bool {
+	host, ok := NetworkFromIP(address)
+	return ok && n.containsAddress(host)
+}
+
+// containsAddress reports whether the first address of other falls within the Network
+func (n Network) containsAddress(other Network) bool {
+	return n.isV6 == other.isV6 && other.masked(n.ones) == n
+}
+
+// Before reports whether the Network sorts ahead of other
+func (n Network) Before(other Network) bool {
+	if n.isV6 != other.isV6 {
+		return !n.isV6
+	}
+	if n.hi != other.hi {
+		return n.hi < other.hi
+	}
+	if n.lo != other.lo {
+		return n.lo < other.lo
+	}
+	return n.ones < other.ones
+}
+
+func (n Network) masked(ones uint8) Network {
+	if ones <= 64 {
+		return Network{hi: n.hi &^ (^uint64(0) >> ones), ones: ones, isV6: n.isV6}
+	}
+	return Network{hi: n.hi, lo: n.lo &^ (^uint64(0) >> (ones - 64)), ones: ones, isV6: n.isV6}
+}
+
+// halves splits the Network into its lower and upper subnets
+func (n Network) halves() (Network, Network, bool) {
+	if n.ones >= n.Bits() {
+		return Network{}, Network{}, false
+	}
+	lower := n.masked(n.ones + 1)
+	upper := lower
+	if n.ones < 64 {
+		upper.hi |= 1 << (63 - n.ones)
+	} else {
+		upper.lo |= 1 << (127 - n.ones)
+	}
+	return lower, upper, true
+}
+
+// supernet returns the Network that is one bit shorter
+func (n Network) supernet() (Network, bool) {
+	if n.ones == 0 {
+		return Network{}, false
+	}
+	return n.masked(n.ones - 1), true
+}
+
+// join returns the supernet formed when n and other are its lower and upper halves
+func (n Network) join(other Network) (Network, bool) {
+	supernet, ok := n.supernet()
+	if !ok || n == other || n.ones != other.ones || supernet.hi != n.hi || supernet.lo != n.lo || !supernet.Contains(other) {
+		return Network{}, false
+	}
+	return supernet, true
+}
+
+// lastAddress returns the highest host address within the Network
+func (n Network) lastAddress() Network {
+	last := n
+	last.ones = n.Bits()
+	if n.ones < 64 {
+		last.hi |= ^uint64(0) >> n.ones
+		last.lo = ^uint64(0)
+	} else {
+		last.lo |= ^uint64(0) >> (n.ones - 64)
+	}
+	if !n.isV6 {
+		last.hi &^= ^uint64(0) >> 32
+		last.lo = 0
+	}
+	return last
+}
+
+func (n Network) bit(i uint8) int {
+	if i < 64 {
+		return int(n.hi >> (63 - i) & 1)
+	}
+	return int(n.lo >> (127 - i) & 1)
+}
+
+func commonBits(a, b Network) uint8 {
+	if x := a.hi ^ b.hi; x != 0 {
+		return uint8(bits.LeadingZeros64(x))
+	}
+	return 64 + uint8(bits.LeadingZeros64(a.lo^b.lo))
+}
+
+// MarshalBinary encodes the Network into 18 bytes
+func (n Network) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 18)
+	binary.BigEndian.PutUint64(b[0:8], n.hi)
+	binary.BigEndian.PutUint64(b[8:16], n.lo)
+	b[16] = n.ones
+	if n.isV6 {
+		b[17] = 1
+	}
+	return b, nil
+}
+
+// UnmarshalBinary decodes a Network written by MarshalBinary
+func (n *Network) UnmarshalBinary(b []byte) error {
+	if len(b) != 18 {
+		return errors.New("invalid network encoding")
+	}
+	n.hi = binary.BigEndian.Uint64(b[0:8])
+	n.lo = binary.BigEndian.Uint64(b[8:16])
+	n.ones = b[16]
+	n.isV6 = b[17] == 1
+	if n.ones > n.Bits() {
+		return errors.New("invalid network encoding")
+	}
+	return nil
+}
+
+// MarshalText encodes the Network in CIDR notation
+func (n Network) MarshalText() ([]byte, error) {
+	return []byte(n.String()), nil
+}
+
+// UnmarshalText parses a Network in CIDR notation
+func (n *Network) UnmarshalText(b []byte) error {
+	network, err := ParseNetwork(string(b))
+	if err != nil {
+		return err
+	}
+	*n = network
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net"
+	"testing"
+)
+
+func TestNetworkConversions(t *testing.T) {
+	for _, s := range []string{"0.0.0.0/0", "10.0.0.0/8", "192.0.2.128/25", "255.255.255.255/32", "::/0", "2001:db8::/32", "2001:db8::1/128"} {
+		_, ipNet, _ := net.ParseCIDR(s)
+		network, ok := NetworkFromIPNet(ipNet)
+		if !ok || network.String() != s || network.IPNet().String() != s {
+			t.Errorf("%v converted to %v", s, network)
+		}
+		b, _ := network.MarshalBinary()
+		var decoded Network
+		if err := decoded.UnmarshalBinary(b); err != nil || decoded != network {
+			t.Errorf("%v decoded as %v", network, decoded)
+		}
+	}
+	mapped := &net.IPNet{IP: net.ParseIP("::ffff:192.0.2.0"), Mask: net.CIDRMask(120, 128)}
+	if network, ok := NetworkFromIPNet(mapped); !ok || network != mustParseNetwork("192.0.2.0/24") {
+		t.Error("IPv4-mapped network converted to", network)
+	}
+}
+
+func TestNetworkArithmetic(t *testing.T) {
+	lower, upper, ok := mustParseNetwork("10.0.0.0/8").halves()
+	if !ok || lower != mustParseNetwork("10.0.0.0/9") || upper != mustParseNetwork("10.128.0.0/9") {
+		t.Error("halves of 10.0.0.0/8 are", lower, upper)
+	}
+	if last := mustParseNetwork("10.0.0.0/8").lastAddress(); last != mustParseNetwork("10.255.255.255/32") {
+		t.Error("last address of 10.0.0.0/8 is", last)
+	}
+	if last := mustParseNetwork("2001:db8::/64").lastAddress(); last != mustParseNetwork("2001:db8::ffff:ffff:ffff:ffff/128") {
+		t.Error("last address of 2001:db8::/64 is", last)
+	}
+	if _, _, ok := mustParseNetwork("192.0.2.1/32").halves(); ok {
+		t.Error("a host network should not have halves")
+	}
+	if !mustParseNetwork("10.0.0.0/8").Contains(mustParseNetwork("10.1.0.0/16")) ||
+		mustParseNetwork("10.1.0.0/16").Contains(mustParseNetwork("10.0.0.0/8")) ||
+		mustParseNetwork("0.0.0.0/0").Contains(mustParseNetwork("::/0")) {
+		t.Error("Contains returned the wrong result")
+	}
+}
+
+func TestNetworkOrder(t *testing.T) {
+	v4, v6 := mustParseNetwork("255.255.255.0/24"), mustParseNetwork("2001:db8::/32")
+	if !v4.Before(v6) || v6.Before(v4) {
+		t.Error("IPv4 networks should sort ahead of IPv6 networks")
+	}
+	if !mustParseNetwork("10.0.0.0/8").Before(mustParseNetwork("10.0.0.0/16")) ||
+		!mustParseNetwork("10.0.0.0/16").Before(mustParseNetwork("10.1.0.0/16")) {
+		t.Error("networks should sort by address and then by prefix length")
+	}
+}
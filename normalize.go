@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/binary"
+	"net"
+	"strings"
+)
+
+// Transformation names the way an IPv6 address was reduced to the IPv4 address it embeds
+type Transformation uint8
+
+const (
+	TransformNone           Transformation = iota
+	TransformIPv4Mapped                    // ::ffff:0:0/96, always applied and only reported by ParseAddress
+	TransformIPv4Compatible                // ::/96, deprecated by RFC 4291
+	Transform6to4                          // 2002::/16, RFC 3056
+	TransformTeredo                        // 2001::/32, RFC 4380
+	TransformNAT64                         // 64:ff9b::/96, RFC 6052
+)
+
+var transformationNames = []string{"none", "ipv4-mapped", "ipv4-compatible", "6to4", "teredo", "nat64"}
+
+func (t Transformation) String() string {
+	if int(t) < len(transformationNames) {
+		return transformationNames[t]
+	}
+	return transformationNames[TransformNone]
+}
+
+// MarshalText encodes the Transformation by name
+func (t Transformation) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+func parseTransformation(s string) Transformation {
+	for i, name := range transformationNames {
+		if name == s {
+			return Transformation(i)
+		}
+	}
+	return TransformNone
+}
+
+var (
+	sixToFourPrefix  = mustParseNetwork("2002::/16")
+	teredoPrefix     = mustParseNetwork("2001::/32")
+	nat64Prefix      = mustParseNetwork("64:ff9b::/96")
+	compatiblePrefix = mustParseNetwork("::/96")
+)
+
+// ParseAddress parses an address and applies Normalize to it, reporting IPv4-mapped input
+// that net.IP cannot distinguish from IPv4. It returns nil when the address is not valid.
+func ParseAddress(s string, enabled ...Transformation) (net.IP, Transformation) {
+	address := net.ParseIP(s)
+	if address == nil {
+		return nil, TransformNone
+	}
+	if ip := address.To4(); ip != nil && strings.Contains(s, ":") {
+		return ip, TransformIPv4Mapped
+	}
+	return Normalize(address, enabled...)
+}
+
+// Normalize returns the IPv4 address embedded in an IPv6 address when one of the enabled
+// transformations applies and reports which one was used
+func Normalize(address net.IP, enabled ...Transformation) (net.IP, Transformation) {
+	if ip := address.To4(); ip != nil {
+		return ip, TransformNone
+	}
+	ip := address.To16()
+	host, ok := NetworkFromIP(address)
+	if !ok {
+		return address, TransformNone
+	}
+	for _, transformation := range enabled {
+		var embedded net.IP
+		switch transformation {
+		case TransformIPv4Compatible:
+			// the unspecified, loopback and other 0.0.0.0/8 addresses are not IPv4-compatible
+			if compatiblePrefix.containsAddress(host) && ip[12] != 0 {
+				embedded = ip[12:16]
+			}
+		case Transform6to4:
+			if sixToFourPrefix.containsAddress(host) {
+				embedded = ip[2:6]
+			}
+		case TransformTeredo:
+			if teredoPrefix.containsAddress(host) {
+				embedded = make(net.IP, net.IPv4len)
+				binary.BigEndian.PutUint32(embedded, ^binary.BigEndian.Uint32(ip[12:16]))
+			}
+		case TransformNAT64:
+			if nat64Prefix.containsAddress(host) {
+				embedded = ip[12:16]
+			}
+		}
+		if embedded != nil {
+			return net.IPv4(embedded[0], embedded[1], embedded[2], embedded[3]).To4(), transformation
+		}
+	}
+	return address, TransformNone
+}
+
+// LookupNormalized behaves like LookupLayered after applying Normalize to the address
+func (tree *Tree) LookupNormalized(address net.IP, enabled ...Transformation) (*Node, PrecisionLevel, Transformation) {
+	normalized, transformation := Normalize(address, enabled...)
+	n, precision := tree.LookupLayered(normalized)
+	return n, precision, transformation
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	all := []Transformation{TransformIPv4Compatible, Transform6to4, TransformTeredo, TransformNAT64}
+	for _, test := range []struct {
+		address        string
+		enabled        []Transformation
+		normalized     string
+		transformation Transformation
+	}{
+		{"192.0.2.1", all, "192.0.2.1", TransformNone},
+		{"::192.0.2.1", all, "192.0.2.1", TransformIPv4Compatible},
+		{"::192.0.2.1", nil, "::192.0.2.1", TransformNone},
+		{"::1", all, "::1", TransformNone},
+		{"::", all, "::", TransformNone},
+		{"2002:c000:0201::1", all, "192.0.2.1", Transform6to4},
+		{"2002:c000:0201::1", []Transformation{TransformNAT64}, "2002:c000:201::1", TransformNone},
+		{"2001:0:4136:e378:8000:63bf:3fff:fdd2", all, "192.0.2.45", TransformTeredo},
+		{"64:ff9b::c000:201", all, "192.0.2.1", TransformNAT64},
+		{"64:ff9b:1::c000:201", all, "64:ff9b:1::c000:201", TransformNone},
+		{"2001:db8::1", all, "2001:db8::1", TransformNone},
+		{"::ffff:192.0.2.1", nil, "192.0.2.1", TransformIPv4Mapped},
+		{"::ffff:c000:201", all, "192.0.2.1", TransformIPv4Mapped},
+	} {
+		normalized, transformation := ParseAddress(test.address, test.enabled...)
+		if !normalized.Equal(net.ParseIP(test.normalized)) || transformation != test.transformation {
+			t.Errorf("%v normalized to %v with %v instead of %v with %v",
+				test.address, normalized, transformation, test.normalized, test.transformation)
+		}
+		if transformation != TransformNone && len(normalized) != net.IPv4len {
+			t.Errorf("%v should normalize to a 4 byte address", test.address)
+		}
+	}
+	if address, _ := ParseAddress("bogus"); address != nil {
+		t.Errorf("an invalid address was parsed as %v", address)
+	}
+}
+
+func TestLookupNormalized(t *testing.T) {
+	tree := NewTree(16)
+	paris := &GeoPosition{Location: &GeoLocation{CityName: "Paris", CountryISO: "FR"}}
+	tree.insert(paris, mustParseNetwork("45.4.0.0/24"))
+	n, precision, transformation := tree.LookupNormalized(net.ParseIP("2002:2d04:1::1"), Transform6to4)
+	if n == nil || n.GeoPosition != paris || precision != PrecisionCity || transformation != Transform6to4 {
+		t.Errorf("6to4 address resolved to %v with %v and %v", n, precision, transformation)
+	}
+	if n, _, _ := tree.LookupNormalized(net.ParseIP("2002:2d04:1::1")); n != nil {
+		t.Error("6to4 addresses should only be normalized when enabled")
+	}
+
+	recorder := httptest.NewRecorder()
+	newServeMux(tree).ServeHTTP(recorder, httptest.NewRequest("GET", "/lookup?ip=64:ff9b::2d04:1&normalize=nat64,teredo", nil))
+	var result struct {
+		Network        string `json:"network"`
+		Transformation string `json:"transformation"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Network != "45.4.0.0/24" || result.Transformation != "nat64" {
+		t.Errorf("unexpected /lookup response: %v", recorder.Body.String())
+	}
+	recorder = httptest.NewRecorder()
+	newServeMux(tree).ServeHTTP(recorder, httptest.NewRequest("GET", "/lookup?ip=::1&normalize=bogus", nil))
+	if recorder.Code != 400 {
+		t.Errorf("an unknown transformation was accepted")
+	}
+}
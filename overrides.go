@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Override corrects the position of an in-house network or a network that the datasets get wrong
+type Override struct {
+	Network     Network      `json:"network"`
+	Note        string       `json:"note,omitempty"`
+	GeoPosition *GeoPosition `json:"geoPosition"`
+}
+
+// LoadOverrides reads an overrides file. The format is chosen by extension: .csv files need a header
+// naming the columns, .json files hold an array of objects and .yaml or .yml files hold a flat list of
+// mappings. Every entry has a cidr and a country, and may have latitude, longitude, city and note.
+// Entries without coordinates are placed at the centre of their country.
+func LoadOverrides(filename string) ([]*Override, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var entries []map[string]string
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".csv":
+		entries, err = readOverridesCSV(f)
+	case ".json":
+		entries, err = readOverridesJSON(f)
+	case ".yaml", ".yml":
+		entries, err = readOverridesYAML(f)
+	default:
+		return nil, fmt.Errorf("'%v' is not a csv, json or yaml file", filename)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read '%v' because: %v", filename, err)
+	}
+	overrides := make([]*Override, 0, len(entries))
+	for i, entry := range entries {
+		override, err := newOverride(entry)
+		if err != nil {
+			return nil, fmt.Errorf("entry %v of '%v' %v", i+1, filename, err)
+		}
+		overrides = append(overrides, override)
+	}
+	return overrides, nil
+}
+
+func newOverride(entry map[string]string) (*Override, error) {
+	network, err := ParseNetwork(entry["cidr"])
+	if err != nil {
+		return nil, fmt.Errorf("has an invalid cidr '%v'", entry["cidr"])
+	}
+	country := strings.ToUpper(entry["country"])
+	coarsePosition := coarseCountryPositions[country]
+	if coarsePosition == nil {
+		return nil, fmt.Errorf("has an unsupported country '%v'", entry["country"])
+	}
+	geoPosition := &GeoPosition{
+		Latitude:  coarsePosition.Latitude,
+		Longitude: coarsePosition.Longitude,
+		Location:  &GeoLocation{CityName: entry["city"], CountryISO: country},
+		Source:    SourceOverride,
+	}
+	if entry["latitude"] != "" || entry["longitude"] != "" {
+		latitude, latError := strconv.ParseFloat(entry["latitude"], 64)
+		longitude, longError := strconv.ParseFloat(entry["longitude"], 64)
+		if latError != nil || longError != nil || latitude < -90 || latitude > 90 || longitude < -180 || longitude > 180 {
+			return nil, fmt.Errorf("has invalid coordinates '%v,%v'", entry["latitude"], entry["longitude"])
+		}
+		geoPosition.Latitude, geoPosition.Longitude = latitude, longitude
+	}
+	return &Override{Network: network, Note: entry["note"], GeoPosition: geoPosition}, nil
+}
+
+func readOverridesCSV(r io.Reader) ([]map[string]string, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	var entries []map[string]string
+	for {
+		lineColumns, err := reader.Read()
+		if err == io.EOF {
+			return entries, nil
+		} else if err != nil {
+			return nil, err
+		}
+		entry := map[string]string{}
+		for i, column := range lineColumns {
+			entry[strings.ToLower(strings.TrimSpace(header[i]))] = strings.TrimSpace(column)
+		}
+		entries = append(entries, entry)
+	}
+}
+
+func readOverridesJSON(r io.Reader) ([]map[string]string, error) {
+	var objects []map[string]interface{}
+	if err := json.NewDecoder(r).Decode(&objects); err != nil {
+		return nil, err
+	}
+	entries := make([]map[string]string, 0, len(objects))
+	for _, object := range objects {
+		entry := map[string]string{}
+		for key, value := range object {
+			if value != nil {
+				entry[strings.ToLower(key)] = fmt.Sprint(value)
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// readOverridesYAML understands the subset of YAML needed for a list of flat mappings
+func readOverridesYAML(r io.Reader) ([]map[string]string, error) {
+	var entries []map[string]string
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || text == "---" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		if strings.HasPrefix(text, "- ") || text == "-" {
+			entries = append(entries, map[string]string{})
+			text = strings.TrimSpace(strings.TrimPrefix(text, "-"))
+			if text == "" {
+				continue
+			}
+		}
+		separator := strings.Index(text, ":")
+		if separator < 0 || len(entries) == 0 {
+			return nil, fmt.Errorf("line %v is not a key of a list item", line)
+		}
+		value := strings.TrimSpace(text[separator+1:])
+		if comment := strings.Index(value, " #"); comment >= 0 && !strings.HasPrefix(value, `"`) && !strings.HasPrefix(value, "'") {
+			value = strings.TrimSpace(value[:comment])
+		}
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		} else if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+			value = strings.ReplaceAll(value[1:len(value)-1], "''", "'")
+		}
+		entries[len(entries)-1][strings.ToLower(strings.TrimSpace(text[:separator]))] = value
+	}
+	return entries, scanner.Err()
+}
+
+// SetOverrides replaces the overrides of the tree. The network of every override is inserted with
+// the override position and the networks within it lose theirs, so every query and export resolves
+// the whole network to the override. When two overrides share a network the last one wins.
+// SetOverrides must not run concurrently with queries when it changes the overrides.
+func (tree *Tree) SetOverrides(overrides []*Override) {
+	tree.overridesMtx.Lock()
+	defer tree.overridesMtx.Unlock()
+	index := newPrefixIndex[*Override]()
+	for _, override := range overrides {
+		index.add(override.Network, override)
+	}
+	for i := len(tree.overridden) - 1; i >= 0; i-- {
+		tree.overridden[i].node.GeoPosition = tree.overridden[i].geoPosition
+	}
+	tree.overridden = nil
+	sorted := append([]*Override{}, overrides...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Network.Before(sorted[j].Network) })
+	for _, override := range sorted {
+		tree.applyOverride(override)
+	}
+	tree.mtx.Lock()
+	tree.overrides = index
+	tree.mtx.Unlock()
+	tree.modified()
+}
+
+// overriddenPosition is a position that an override replaced and that is restored when it is removed
+type overriddenPosition struct {
+	node        *Node
+	geoPosition *GeoPosition
+}
+
+func (tree *Tree) applyOverride(override *Override) {
+	n := tree.findOverrideNode(override.Network)
+	if n == nil || n.Network != override.Network {
+		tree.insert(nil, override.Network)
+		n = tree.findOverrideNode(override.Network)
+	}
+	tree.overridden = append(tree.overridden, overriddenPosition{n, n.GeoPosition})
+	n.GeoPosition = override.GeoPosition
+	var clear func(nodes []*Node)
+	clear = func(nodes []*Node) {
+		for _, child := range nodes {
+			if child.GeoPosition != nil {
+				tree.overridden = append(tree.overridden, overriddenPosition{child, child.GeoPosition})
+				child.GeoPosition = nil
+			}
+			clear(child.Children)
+		}
+	}
+	clear(n.Children)
+}
+
+func (tree *Tree) findOverrideNode(network Network) *Node {
+	if network.IsV6() {
+		return tree.findClosestSupernet(network, tree.RootsV6)
+	}
+	return tree.findClosestSupernet(network, tree.Roots)
+}
+
+// ReloadOverrides loads an overrides file and swaps it in, keeping the previous overrides on failure
+func (tree *Tree) ReloadOverrides(filename string) error {
+	overrides, err := LoadOverrides(filename)
+	if err != nil {
+		return err
+	}
+	tree.SetOverrides(overrides)
+	return nil
+}
+
+// LookupOverride returns the most specific override that contains the address
+func (tree *Tree) LookupOverride(address net.IP) *Override {
+	host, ok := NetworkFromIP(address)
+	if !ok {
+		return nil
+	}
+	tree.mtx.RLock()
+	defer tree.mtx.RUnlock()
+	override, _ := tree.overrides.lookup(host)
+	return override
+}
+
+// OverrideIssue is a problem found by ValidateOverrides. Errors are overrides that can never take
+// effect while warnings are overlaps and corrections that should be deliberate.
+type OverrideIssue struct {
+	Network Network `json:"network"`
+	Error   bool    `json:"error"`
+	Message string  `json:"message"`
+}
+
+func (issue OverrideIssue) String() string {
+	if issue.Error {
+		return "error: " + issue.Network.String() + ": " + issue.Message
+	}
+	return "warning: " + issue.Network.String() + ": " + issue.Message
+}
+
+// ValidateOverrides reports overrides that duplicate or nest within each other and overrides whose
+// country disagrees with the GeoLite or registry data underneath them
+func (tree *Tree) ValidateOverrides(overrides []*Override) []OverrideIssue {
+	sorted := append([]*Override{}, overrides...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Network.Before(sorted[j].Network) })
+	var issues []OverrideIssue
+	for i, override := range sorted {
+		for j, other := range sorted[:i] {
+			if other.Network == override.Network {
+				issues = append(issues, OverrideIssue{override.Network, true, "is listed more than once"})
+				break
+			} else if other.Network.Contains(override.Network) && (j == 0 || sorted[j-1].Network != other.Network) {
+				issues = append(issues, OverrideIssue{override.Network, false, "is nested within " + other.Network.String()})
+			}
+		}
+		country := override.GeoPosition.Location.CountryISO
+		for _, layer := range []*Tree{tree, tree.Registry} {
+			if layer == nil {
+				continue
+			}
+			if n := layer.Covering(override.Network.IPNet()); n != nil && n.GeoPosition.Location != nil &&
+				n.GeoPosition.Location.CountryISO != country {
+				issues = append(issues, OverrideIssue{override.Network, false, fmt.Sprintf("replaces %v in %v from %v",
+					n.Network, n.GeoPosition.Location.CountryISO, n.GeoPosition.Source)})
+			}
+			conflicts := map[string]int{}
+			for _, n := range layer.Covered(override.Network.IPNet()) {
+				if n.Network != override.Network && n.GeoPosition.Location != nil && n.GeoPosition.Location.CountryISO != country {
+					conflicts[n.GeoPosition.Location.CountryISO]++
+				}
+			}
+			countries := make([]string, 0, len(conflicts))
+			for other := range conflicts {
+				countries = append(countries, other)
+			}
+			sort.Strings(countries)
+			for _, other := range countries {
+				issues = append(issues, OverrideIssue{override.Network, false,
+					fmt.Sprintf("masks %v networks in %v from %v", conflicts[other], other, layerSource(layer, tree))})
+			}
+		}
+	}
+	return issues
+}
+
+func layerSource(layer, tree *Tree) string {
+	if layer == tree {
+		return SourceGeoLite.String()
+	}
+	return "the registries"
+}
+
+func checkOverridesCommand(args []string) {
+	flags := flag.NewFlagSet("check-overrides", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print the issues as JSON")
+	treeFile := treeFlag(flags)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: networktree check-overrides [-json] [-tree file] file")
+		flags.PrintDefaults()
+	}
+	parseFlags(flags, args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		exit(exitUsage)
+	}
+	overrides, err := LoadOverrides(flags.Arg(0))
+	if err != nil {
+		fatalf("unable to check overrides because: %v", err)
+	}
+	issues := loadTree(*treeFile).ValidateOverrides(overrides)
+	failed := false
+	if *asJSON {
+		if issues == nil {
+			issues = []OverrideIssue{}
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(issues); err != nil {
+			fatalf("unable to print issues because: %v", err)
+		}
+	}
+	for _, issue := range issues {
+		if !*asJSON {
+			fmt.Println(issue)
+		}
+		failed = failed || issue.Error
+	}
+	if failed {
+		exit(exitIssues)
+	}
+}
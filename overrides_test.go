@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func writeOverrides(t *testing.T, name, contents string) string {
+	filename := path.Join(t.TempDir(), name)
+	if err := os.WriteFile(filename, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestLoadOverrides(t *testing.T) {
+	for name, contents := range map[string]string{
+		"overrides.csv": "# in-house networks\n" +
+			"cidr,latitude,longitude,city,country,note\n" +
+			"10.20.0.0/16,52.52,13.40,Berlin,de,\"office, 3rd floor\"\n" +
+			"45.0.0.0/24,,,,BR,wrong in geolite\n",
+		"overrides.json": `[
+			{"cidr": "10.20.0.0/16", "latitude": 52.52, "longitude": 13.40, "city": "Berlin", "country": "de", "note": "office, 3rd floor"},
+			{"cidr": "45.0.0.0/24", "country": "BR", "note": "wrong in geolite"}
+		]`,
+		"overrides.yaml": "---\n" +
+			"- cidr: 10.20.0.0/16\n" +
+			"  latitude: 52.52\n" +
+			"  longitude: 13.40\n" +
+			"  city: Berlin # the main office\n" +
+			"  country: de\n" +
+			"  note: \"office, 3rd floor\"\n" +
+			"-\n" +
+			"  cidr: 45.0.0.0/24\n" +
+			"  country: 'BR'\n" +
+			"  note: wrong in geolite\n",
+	} {
+		overrides, err := LoadOverrides(writeOverrides(t, name, contents))
+		if err != nil {
+			t.Fatalf("unable to load %v: %v", name, err)
+		}
+		if len(overrides) != 2 {
+			t.Fatalf("%v returned %v overrides", name, len(overrides))
+		}
+		office, correction := overrides[0], overrides[1]
+		if office.Network != mustParseNetwork("10.20.0.0/16") || office.Note != "office, 3rd floor" ||
+			office.GeoPosition.Latitude != 52.52 || office.GeoPosition.Longitude != 13.40 ||
+			office.GeoPosition.Location.CityName != "Berlin" || office.GeoPosition.Location.CountryISO != "DE" ||
+			office.GeoPosition.Source != SourceOverride {
+			t.Errorf("unexpected first override in %v: %+v %+v", name, office, office.GeoPosition)
+		}
+		if correction.GeoPosition.Latitude != coarseCountryPositions["BR"].Latitude ||
+			correction.GeoPosition.Location.CityName != "" || correction.Note != "wrong in geolite" {
+			t.Errorf("unexpected second override in %v: %+v %+v", name, correction, correction.GeoPosition)
+		}
+	}
+	for name, contents := range map[string]string{
+		"cidr.csv":        "cidr,country\n10.0.0.0/33,DE\n",
+		"country.csv":     "cidr,country\n10.0.0.0/8,XX\n",
+		"coordinates.csv": "cidr,country,latitude,longitude\n10.0.0.0/8,DE,91,0\n",
+		"longitude.json":  `[{"cidr": "10.0.0.0/8", "country": "DE", "latitude": 50}]`,
+		"list.yaml":       "cidr: 10.0.0.0/8\n",
+		"overrides.txt":   "cidr,country\n10.0.0.0/8,DE\n",
+	} {
+		if _, err := LoadOverrides(writeOverrides(t, name, contents)); err == nil {
+			t.Errorf("%v should have been rejected", name)
+		}
+	}
+}
+
+func TestOverridePrecedence(t *testing.T) {
+	writeGeoliteFixtures(t, []string{"45.0.0.0/16,1,,,0,0,,48.85,2.35,20"}, nil)
+	tree := NewTree(16)
+	ingestGeoliteData(tree)
+	tree.AddSpecialPurpose(mustParseNetwork("10.20.0.0/16"), "office", ClassPrivate,
+		&GeoPosition{Location: &GeoLocation{CountryISO: "US"}})
+	filename := writeOverrides(t, "overrides.csv", "cidr,latitude,longitude,city,country,note\n"+
+		"10.20.0.0/16,52.52,13.40,Berlin,DE,office\n"+
+		"45.0.0.0/24,,,,BR,wrong in geolite\n")
+	if err := tree.ReloadOverrides(filename); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		address   string
+		network   string
+		precision PrecisionLevel
+		source    Source
+		country   string
+	}{
+		{"10.20.1.1", "10.20.0.0/16", PrecisionCity, SourceOverride, "DE"},
+		{"45.0.0.1", "45.0.0.0/24", PrecisionCountry, SourceOverride, "BR"},
+		{"45.0.1.1", "45.0.0.0/16", PrecisionCity, SourceGeoLite, "FR"},
+	} {
+		n, precision := tree.LookupLayered(net.ParseIP(test.address))
+		if n == nil || n.Network != mustParseNetwork(test.network) || precision != test.precision ||
+			n.GeoPosition.Source != test.source || n.GeoPosition.Location.CountryISO != test.country {
+			t.Errorf("%v resolved to %+v with precision %v", test.address, n, precision)
+		}
+	}
+
+	if n := tree.Lookup(net.ParseIP("45.0.0.1")); n == nil || n.GeoPosition.Source != SourceOverride {
+		t.Errorf("Lookup ignored the override and returned %+v", n)
+	}
+	if networks := tree.NetworksByCountry("BR"); len(networks) != 1 || networks[0].Network != mustParseNetwork("45.0.0.0/24") {
+		t.Errorf("unexpected networks in BR: %v", networks)
+	}
+	var csv bytes.Buffer
+	if err := writeCSV(&csv, tree); err != nil || !strings.Contains(csv.String(), "\n45.0.0.0/24,") ||
+		!strings.Contains(csv.String(), ",BR,,false,override\n") {
+		t.Errorf("the CSV export ignored the override: %q", csv.String())
+	}
+
+	recorder := httptest.NewRecorder()
+	newServeMux(tree).ServeHTTP(recorder, httptest.NewRequest("GET", "/lookup?ip=10.20.1.1", nil))
+	var result struct {
+		Source string `json:"source"`
+		Note   string `json:"note"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Source != "override" || result.Note != "office" {
+		t.Errorf("unexpected /lookup response: %v", recorder.Body.String())
+	}
+
+	if err := os.WriteFile(filename, []byte("cidr,country\n45.0.0.0/24,XX\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.ReloadOverrides(filename); err == nil {
+		t.Error("an invalid file should not have been reloaded")
+	} else if tree.LookupOverride(net.ParseIP("45.0.0.1")) == nil {
+		t.Error("the previous overrides should be kept when a reload fails")
+	}
+	if err := os.WriteFile(filename, []byte("cidr,country\n45.0.0.0/25,AR\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.ReloadOverrides(filename); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := tree.LookupLayered(net.ParseIP("10.20.1.1")); n.GeoPosition.Location.CountryISO != "US" {
+		t.Error("overrides that were removed by a reload should no longer be returned")
+	}
+	for address, country := range map[string]string{"45.0.0.1": "AR", "45.0.0.200": "FR", "45.0.1.1": "FR"} {
+		if n := tree.Lookup(net.ParseIP(address)); n == nil || n.GeoPosition.Location.CountryISO != country {
+			t.Errorf("%v resolved to %+v instead of %v after the reload", address, n, country)
+		}
+	}
+	if len(tree.NetworksByCountry("BR")) != 0 || len(tree.Covered(mustParseNetwork("10.20.0.0/16").IPNet())) != 0 {
+		t.Error("overrides that were removed by a reload are still in the tree")
+	}
+	if n, _ := tree.LookupLayered(net.ParseIP("45.0.0.1")); n.GeoPosition.Location.CountryISO != "AR" {
+		t.Error("overrides that were added by a reload should be returned")
+	}
+}
+
+func TestValidateOverrides(t *testing.T) {
+	writeGeoliteFixtures(t, []string{
+		"45.0.0.0/16,1,,,0,0,,48.85,2.35,20",
+		"45.1.0.0/24,3,,,0,0,,,,",
+		"45.1.1.0/24,3,,,0,0,,50.1,8.6,50",
+		"45.1.2.0/24,1,,,0,0,,48.85,2.35,20",
+	}, nil)
+	tree := NewTree(16)
+	ingestGeoliteData(tree)
+	tree.Compact()
+	overrides, err := LoadOverrides(writeOverrides(t, "overrides.csv", "cidr,country\n"+
+		"45.0.0.0/24,FR\n"+
+		"45.0.1.0/24,BR\n"+
+		"45.1.0.0/22,FR\n"+
+		"10.0.0.0/8,DE\n"+
+		"10.1.0.0/16,DE\n"+
+		"10.0.0.0/8,US\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var messages []string
+	for _, issue := range tree.ValidateOverrides(overrides) {
+		messages = append(messages, issue.String())
+	}
+	expected := []string{
+		"error: 10.0.0.0/8: is listed more than once",
+		"warning: 10.1.0.0/16: is nested within 10.0.0.0/8",
+		"warning: 45.0.1.0/24: replaces 45.0.0.0/16 in FR from geolite2-city",
+		"warning: 45.1.0.0/22: masks 2 networks in DE from geolite2-city",
+	}
+	if len(messages) != len(expected) {
+		t.Fatalf("unexpected issues: %q", messages)
+	}
+	for i := range expected {
+		if messages[i] != expected[i] {
+			t.Errorf("issue %v was %q instead of %q", i, messages[i], expected[i])
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+// prefixIndex finds the most specific of a small set of networks that contains an address
+// by probing each prefix length in use, which is cheaper than a tree for a few thousand entries
+type prefixIndex[V any] struct {
+	values  map[Network]V
+	lengths [2][129]bool // prefix lengths in use for IPv4 and IPv6
+}
+
+func newPrefixIndex[V any]() *prefixIndex[V] {
+	return &prefixIndex[V]{values: map[Network]V{}}
+}
+
+// add stores the value for the network, replacing any previous value
+func (index *prefixIndex[V]) add(network Network, value V) {
+	family := 0
+	if network.IsV6() {
+		family = 1
+	}
+	index.values[network] = value
+	index.lengths[family][network.Ones()] = true
+}
+
+func (index *prefixIndex[V]) lookup(host Network) (V, bool) {
+	family := 0
+	if host.IsV6() {
+		family = 1
+	}
+	for ones := int(host.Bits()); ones >= 0; ones-- {
+		if index.lengths[family][ones] {
+			if value, found := index.values[host.masked(uint8(ones))]; found {
+				return value, true
+			}
+		}
+	}
+	var zero V
+	return zero, false
+}
@@ -0,0 +1,416 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/demskie/subnetmath"
+)
+
+// PrecisionLevel describes how specific the position returned by LookupLayered is
+type PrecisionLevel uint8
+
+const (
+	PrecisionNone PrecisionLevel = iota
+	PrecisionRegion
+	PrecisionCountry
+	PrecisionCity
+)
+
+var precisionNames = []string{"none", "region", "country", "city"}
+
+func (p PrecisionLevel) String() string {
+	if int(p) < len(precisionNames) {
+		return precisionNames[p]
+	}
+	return precisionNames[PrecisionNone]
+}
+
+// MarshalText encodes the PrecisionLevel by name
+func (p PrecisionLevel) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// AllocationStatus is the status column of a delegated record
+type AllocationStatus uint8
+
+const (
+	StatusUnknown AllocationStatus = iota
+	StatusAllocated
+	StatusAssigned
+	StatusAvailable
+	StatusReserved
+)
+
+var statusNames = []string{"unknown", "allocated", "assigned", "available", "reserved"}
+
+func (s AllocationStatus) String() string {
+	if int(s) < len(statusNames) {
+		return statusNames[s]
+	}
+	return statusNames[StatusUnknown]
+}
+
+// MarshalText encodes the AllocationStatus by name
+func (s AllocationStatus) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func parseAllocationStatus(s string) AllocationStatus {
+	for i, name := range statusNames {
+		if name == s {
+			return AllocationStatus(i)
+		}
+	}
+	return StatusUnknown
+}
+
+// Allocation holds the metadata of the delegated record that a network was read from
+type Allocation struct {
+	Registry Source           `json:"registry"`
+	Status   AllocationStatus `json:"status"`
+	Date     time.Time        `json:"date"` // zero when the registry did not publish one
+	OpaqueID string           `json:"opaqueId"`
+}
+
+func newAllocation(source Source, lineColumns []string) *Allocation {
+	allocation := &Allocation{Registry: source, Status: parseAllocationStatus(lineColumns[6])}
+	allocation.Date, _ = time.Parse("20060102", lineColumns[5])
+	if len(lineColumns) > 7 {
+		allocation.OpaqueID = lineColumns[7]
+	}
+	return allocation
+}
+
+var delegatedPaths = []string{arinPath, ripePath, apnicPath, afrinicPath, lacnicPath}
+
+var registrySources = map[string]Source{
+	"arin":    SourceARIN,
+	"ripencc": SourceRIPENCC,
+	"apnic":   SourceAPNIC,
+	"afrinic": SourceAFRINIC,
+	"lacnic":  SourceLACNIC,
+}
+
+// registryRegions roughly centers on the service area of each registry
+var registryRegions = map[Source]*GeoPosition{
+	SourceARIN:    {Latitude: 45, Longitude: -95, AccuracyRadius: 4000, Source: SourceARIN},
+	SourceRIPENCC: {Latitude: 50, Longitude: 30, AccuracyRadius: 4000, Source: SourceRIPENCC},
+	SourceAPNIC:   {Latitude: 15, Longitude: 115, AccuracyRadius: 6000, Source: SourceAPNIC},
+	SourceAFRINIC: {Latitude: 2, Longitude: 20, AccuracyRadius: 4000, Source: SourceAFRINIC},
+	SourceLACNIC:  {Latitude: -12, Longitude: -65, AccuracyRadius: 5000, Source: SourceLACNIC},
+}
+
+// ingestRIRData reads the delegated files into tree.Registry, skipping registries that were not downloaded
+func ingestRIRData(tree *Tree) {
+	registry := NewTree(tree.Precision)
+	locations := map[string]*GeoLocation{}
+	var asns []ASNRecord
+	serials := map[Source]time.Time{}
+	for _, delegatedPath := range delegatedPaths {
+		txtFile, err := openInput(delegatedPath)
+		if os.IsNotExist(err) {
+			log.Printf("skipping %v because it does not exist", delegatedPath)
+			continue
+		} else if err != nil {
+			fatalf("unable to ingest delegated data because: %v", err)
+		}
+		fileProgress := progress.track(path.Base(delegatedPath))
+		scanner := bufio.NewScanner(txtFile)
+		validator := &delegatedValidator{}
+		for i := 1; scanner.Scan(); i++ {
+			atomic.AddUint64(&fileProgress.records, 1)
+			lineColumns := strings.Split(scanner.Text(), "|")
+			if isRecord, err := validator.check(lineColumns); err != nil {
+				fatalf("unable to ingest line %v of %v because: %v", i, delegatedPath, err)
+			} else if !isRecord {
+				continue
+			}
+			source := registrySources[lineColumns[0]]
+			if lineColumns[2] == "asn" {
+				record, err := newASNRecord(source, lineColumns)
+				if err != nil {
+					log.Printf("skipping line %v of %v because: %v", i, delegatedPath, err)
+					continue
+				}
+				asns = append(asns, record)
+				continue
+			} else if lineColumns[2] != "ipv4" && lineColumns[2] != "ipv6" {
+				continue
+			}
+			networks, err := delegatedNetworks(registry.sbuf, lineColumns[2], lineColumns[3], lineColumns[4])
+			if err != nil {
+				log.Printf("skipping line %v of %v because: %v", i, delegatedPath, err)
+				continue
+			}
+			geoPosition := registryPosition(locations, source, lineColumns[1])
+			geoPosition.Allocation = newAllocation(source, lineColumns)
+			registry.insert(geoPosition, networks...)
+		}
+		if err := scanner.Err(); err != nil {
+			fatalf("unable to ingest delegated data because: %v", err)
+		}
+		if err := validator.finish(); err != nil {
+			fatalf("unable to ingest %v because: %v", delegatedPath, err)
+		}
+		serials[registrySources[validator.registry]] = validator.serial
+		tree.addSources(txtFile.close(uint64(validator.expected), validator.serial))
+	}
+	registry.Compact()
+	sort.Slice(asns, func(i, j int) bool { return asns[i].First < asns[j].First })
+	tree.Registry = registry
+	tree.ASNs = asns
+	tree.Serials = serials
+	tree.modified()
+}
+
+// delegatedValidator checks the version and summary lines of a delegated file against its records
+type delegatedValidator struct {
+	registry  string
+	serial    time.Time
+	expected  int
+	summaries map[string]int
+	records   map[string]int
+}
+
+// check returns whether the line is a record and an error when it contradicts the header
+func (v *delegatedValidator) check(lineColumns []string) (bool, error) {
+	if strings.HasPrefix(lineColumns[0], "#") || (len(lineColumns) == 1 && lineColumns[0] == "") {
+		return false, nil
+	}
+	if v.records == nil {
+		if len(lineColumns) < 7 {
+			return false, fmt.Errorf("version line has %v columns instead of 7", len(lineColumns))
+		}
+		if _, exists := registrySources[lineColumns[1]]; !exists {
+			return false, fmt.Errorf("registry '%v' is unsupported", lineColumns[1])
+		}
+		serial, err := time.Parse("20060102", lineColumns[2])
+		if err != nil {
+			return false, fmt.Errorf("serial '%v' is not a valid date", lineColumns[2])
+		}
+		expected, err := strconv.Atoi(lineColumns[3])
+		if err != nil {
+			return false, fmt.Errorf("record count '%v' is not valid", lineColumns[3])
+		}
+		v.registry, v.serial, v.expected = lineColumns[1], serial, expected
+		v.summaries, v.records = map[string]int{}, map[string]int{}
+		return false, nil
+	}
+	if len(lineColumns) >= 6 && lineColumns[1] == "*" && lineColumns[5] == "summary" {
+		count, err := strconv.Atoi(lineColumns[4])
+		if err != nil {
+			return false, fmt.Errorf("summary count '%v' is not valid", lineColumns[4])
+		}
+		v.summaries[lineColumns[2]] = count
+		return false, nil
+	}
+	if len(lineColumns) < 7 {
+		return false, fmt.Errorf("record has %v columns instead of at least 7", len(lineColumns))
+	}
+	if lineColumns[0] != v.registry {
+		return false, fmt.Errorf("record belongs to '%v' instead of '%v'", lineColumns[0], v.registry)
+	}
+	if date, err := time.Parse("20060102", lineColumns[5]); err == nil && date.After(v.serial) {
+		return false, fmt.Errorf("record date %v is after the serial %v", lineColumns[5], v.serial.Format("20060102"))
+	}
+	v.records[lineColumns[2]]++
+	return true, nil
+}
+
+// finish reports a truncated file once every line has been checked
+func (v *delegatedValidator) finish() error {
+	if v.records == nil {
+		return fmt.Errorf("version line is missing")
+	}
+	total := 0
+	for _, family := range []string{"asn", "ipv4", "ipv6"} {
+		if v.summaries[family] != v.records[family] {
+			return fmt.Errorf("summary lists %v %v records but found %v", v.summaries[family], family, v.records[family])
+		}
+		total += v.records[family]
+	}
+	if total != v.expected {
+		return fmt.Errorf("version line lists %v records but found %v", v.expected, total)
+	}
+	return nil
+}
+
+// registryPosition places a delegated record at its country or otherwise at the region of the registry
+func registryPosition(locations map[string]*GeoLocation, source Source, countryISO string) *GeoPosition {
+	coarsePosition := coarseCountryPositions[countryISO]
+	if coarsePosition == nil {
+		geoPosition := *registryRegions[source]
+		return &geoPosition
+	}
+	if locations[countryISO] == nil {
+		locations[countryISO] = &GeoLocation{CountryISO: countryISO}
+	}
+	return &GeoPosition{
+		Latitude:  coarsePosition.Latitude,
+		Longitude: coarsePosition.Longitude,
+		Location:  locations[countryISO],
+		Source:    source,
+	}
+}
+
+// delegatedNetworks converts the start and value columns of a delegated record into networks
+func delegatedNetworks(buf *subnetmath.Buffer, family, start, value string) ([]Network, error) {
+	size, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("value '%v' is not a valid number", value)
+	}
+	if family == "ipv4" {
+		return rangeNetworks(buf, net.ParseIP(start), size)
+	}
+	network, err := ParseNetwork(fmt.Sprintf("%v/%v", start, size))
+	if err != nil {
+		return nil, err
+	}
+	if !network.IP().Equal(net.ParseIP(start)) {
+		return nil, fmt.Errorf("%v is not aligned to /%v", start, size)
+	}
+	return []Network{network}, nil
+}
+
+// rangeNetworks returns the fewest CIDR networks that exactly cover count IPv4 addresses from start
+func rangeNetworks(buf *subnetmath.Buffer, start net.IP, count uint64) ([]Network, error) {
+	first := start.To4()
+	if first == nil {
+		return nil, fmt.Errorf("'%v' is not a valid IPv4 address", start)
+	}
+	firstValue := uint64(binary.BigEndian.Uint32(first))
+	if count == 0 || firstValue+count > 1<<32 {
+		return nil, fmt.Errorf("%v addresses starting at %v do not fit in IPv4", count, start)
+	}
+	last := make(net.IP, net.IPv4len)
+	binary.BigEndian.PutUint32(last, uint32(firstValue+count-1))
+	var result []Network
+	for _, subnet := range buf.FindInbetweenSubnets(first, last) {
+		network, ok := NetworkFromIPNet(subnet)
+		if !ok {
+			return nil, fmt.Errorf("%v is not a valid network", subnet)
+		}
+		result = append(result, network)
+	}
+	return result, nil
+}
+
+// LookupLayered returns the GeoLite position for the address and falls back to the country and
+// then the service region of the registry that delegated it, ignoring delegations with an excluded status.
+// Private and bogon special-purpose ranges have no position unless the caller added one,
+// and loaded overrides take precedence over everything else.
+func (tree *Tree) LookupLayered(address net.IP, exclude ...AllocationStatus) (*Node, PrecisionLevel) {
+	cache := tree.lookupCache()
+	if cache == nil || len(exclude) > 0 {
+		return tree.lookupLayered(address, exclude)
+	}
+	host, ok := NetworkFromIP(address)
+	if !ok {
+		return nil, PrecisionNone
+	}
+	key := lookupKey{host: host, layered: true}
+	result, generation, found := cache.get(key)
+	if !found {
+		result.node, result.precision = tree.lookupLayered(address, nil)
+		cache.put(key, generation, result)
+	}
+	return result.node, result.precision
+}
+
+func (tree *Tree) lookupLayered(address net.IP, exclude []AllocationStatus) (*Node, PrecisionLevel) {
+	if override := tree.LookupOverride(address); override != nil {
+		n := &Node{Network: override.Network, GeoPosition: override.GeoPosition}
+		if override.GeoPosition.Location.CityName != "" {
+			return n, PrecisionCity
+		}
+		return n, PrecisionCountry
+	}
+	if special := tree.LookupSpecial(address); special != nil && special.GeoPosition != nil {
+		n := &Node{Network: special.Network, GeoPosition: special.GeoPosition}
+		if special.GeoPosition.Location != nil && special.GeoPosition.Location.CityName != "" {
+			return n, PrecisionCity
+		}
+		return n, PrecisionCountry
+	} else if special != nil && special.Class != ClassReserved {
+		return nil, PrecisionNone
+	}
+	if n := tree.lookup(address); n != nil {
+		if n.GeoPosition.Location != nil && n.GeoPosition.Location.CityName != "" {
+			return n, PrecisionCity
+		}
+		return n, PrecisionCountry
+	}
+	if tree.Registry != nil {
+		if n := tree.Registry.lookupAllocation(address, exclude); n != nil {
+			if n.GeoPosition.Location != nil {
+				return n, PrecisionCountry
+			}
+			return n, PrecisionRegion
+		}
+	}
+	return nil, PrecisionNone
+}
+
+func (tree *Tree) lookupAllocation(address net.IP, exclude []AllocationStatus) *Node {
+	for n := tree.findContaining(address); n != nil; n = n.Parent {
+		if n.GeoPosition != nil && !excludedStatus(n.GeoPosition.Allocation, exclude) {
+			return n
+		}
+	}
+	return nil
+}
+
+func excludedStatus(allocation *Allocation, exclude []AllocationStatus) bool {
+	for _, status := range exclude {
+		if allocation != nil && allocation.Status == status {
+			return true
+		}
+	}
+	return false
+}
+
+// holderKey identifies a holder since every registry assigns its own opaque-ids
+type holderKey struct {
+	registry Source
+	opaqueID string
+}
+
+// NetworksByOpaqueID returns the delegated networks whose records share the opaque-id of a holder in the registry
+func (tree *Tree) NetworksByOpaqueID(registry Source, opaqueID string) []*Node {
+	if tree.Registry == nil {
+		return nil
+	}
+	return tree.Registry.holders()[holderKey{registry, opaqueID}]
+}
+
+func (tree *Tree) holders() map[holderKey][]*Node {
+	tree.mtx.Lock()
+	defer tree.mtx.Unlock()
+	if tree.holderIndex == nil {
+		tree.holderIndex = map[holderKey][]*Node{}
+		var walk func(nodes []*Node)
+		walk = func(nodes []*Node) {
+			for _, n := range nodes {
+				if n.GeoPosition != nil && n.GeoPosition.Allocation != nil && n.GeoPosition.Allocation.OpaqueID != "" {
+					key := holderKey{n.GeoPosition.Allocation.Registry, n.GeoPosition.Allocation.OpaqueID}
+					tree.holderIndex[key] = append(tree.holderIndex[key], n)
+				}
+				walk(n.Children)
+			}
+		}
+		walk(tree.Roots)
+		walk(tree.RootsV6)
+	}
+	return tree.holderIndex
+}
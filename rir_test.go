@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"math/rand"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/demskie/subnetmath"
+)
+
+func writeDelegatedFixtures(t *testing.T, files map[string]string) {
+	gopath, _ := os.LookupEnv("GOPATH")
+	if err := os.MkdirAll(path.Join(gopath, basePath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, contents := range files {
+		if err := os.WriteFile(path.Join(gopath, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLookupLayered(t *testing.T) {
+	writeGeoliteFixtures(t, []string{
+		"45.0.0.0/16,1,,,0,0,,48.85,2.35,20",
+		"45.1.0.0/16,,3,,0,0,,,,",
+	}, nil)
+	writeDelegatedFixtures(t, map[string]string{
+		lacnicPath: "2.3|lacnic|20190106|5|19870101|20190104|-0200\n" +
+			"lacnic|*|asn|*|0|summary\n" +
+			"lacnic|*|ipv4|*|5|summary\n" +
+			"lacnic|*|ipv6|*|0|summary\n" +
+			"lacnic|BR|ipv4|45.0.0.0|65536|19970602|allocated|1\n" +
+			"lacnic|AR|ipv4|45.2.0.0|65536|19970602|allocated|2\n" +
+			"lacnic||ipv4|45.3.0.0|65536||reserved|\n" +
+			"lacnic|CL|ipv4|45.4.0.0|768|20170224|allocated|3\n" +
+			"lacnic|UY|ipv4|45.5.1.0|256|20170224|allocated|4\n",
+		afrinicPath: "2|afrinic|20190107|1|00000000|20190107|00000\n" +
+			"afrinic|*|ipv6|*|1|summary\n" +
+			"afrinic|ZA|ipv6|2c0f:f000::|32|20030110|allocated|F36B9F4B\n",
+	})
+	tree := NewTree(16)
+	ingestGeoliteData(tree)
+	ingestRIRData(tree)
+	if len(tree.Serials) != 2 || tree.Serials[SourceLACNIC].Format("20060102") != "20190106" {
+		t.Errorf("unexpected serials: %v", tree.Serials)
+	}
+
+	for _, test := range []struct {
+		address   string
+		precision PrecisionLevel
+		source    Source
+		country   string
+	}{
+		{"45.0.0.1", PrecisionCity, SourceGeoLite, "FR"},
+		{"45.1.0.1", PrecisionCountry, SourceGeoLite, "DE"},
+		{"45.2.0.1", PrecisionCountry, SourceLACNIC, "AR"},
+		{"45.3.0.1", PrecisionRegion, SourceLACNIC, ""},
+		{"45.4.2.255", PrecisionCountry, SourceLACNIC, "CL"},
+		{"45.4.3.0", PrecisionNone, SourceUnknown, ""},
+		{"45.5.0.255", PrecisionNone, SourceUnknown, ""},
+		{"45.5.1.0", PrecisionCountry, SourceLACNIC, "UY"},
+		{"2c0f:f000::1", PrecisionCountry, SourceAFRINIC, "ZA"},
+	} {
+		n, precision := tree.LookupLayered(net.ParseIP(test.address))
+		if precision != test.precision {
+			t.Errorf("%v was resolved with precision %v instead of %v", test.address, precision, test.precision)
+			continue
+		}
+		if n == nil {
+			continue
+		}
+		country := ""
+		if n.GeoPosition.Location != nil {
+			country = n.GeoPosition.Location.CountryISO
+		}
+		if n.GeoPosition.Source != test.source || country != test.country {
+			t.Errorf("%v resolved to %v in %q instead of %v in %q",
+				test.address, n.GeoPosition.Source, country, test.source, test.country)
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	newServeMux(tree).ServeHTTP(recorder, httptest.NewRequest("GET", "/lookup?ip=45.3.0.1", nil))
+	var result struct {
+		Source    string `json:"source"`
+		Precision string `json:"precision"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Source != "lacnic" || result.Precision != "region" {
+		t.Errorf("unexpected /lookup response: %v", recorder.Body.String())
+	}
+}
+
+func TestAllocationMetadata(t *testing.T) {
+	writeGeoliteFixtures(t, nil, nil)
+	writeDelegatedFixtures(t, map[string]string{
+		afrinicPath: "2|afrinic|20190107|4|00000000|20190107|00000\n" +
+			"afrinic|*|ipv4|*|4|summary\n" +
+			"afrinic|ZA|ipv4|41.0.0.0|65536|20070409|allocated|F36B9F4B\n" +
+			"afrinic|ZA|ipv4|41.1.0.0|65536|20070410|allocated|F36B9F4B\n" +
+			"afrinic|ZZ|ipv4|41.2.0.0|65536||reserved|\n" +
+			"afrinic|ZZ|ipv4|41.3.0.0|65536||available|\n",
+	})
+	tree := NewTree(16)
+	ingestGeoliteData(tree)
+	ingestRIRData(tree)
+
+	n, _ := tree.LookupLayered(net.ParseIP("41.1.2.3"))
+	allocation := n.GeoPosition.Allocation
+	if allocation == nil || allocation.Registry != SourceAFRINIC || allocation.Status != StatusAllocated ||
+		allocation.OpaqueID != "F36B9F4B" || allocation.Date.Format("20060102") != "20070410" {
+		t.Errorf("unexpected allocation for 41.1.2.3: %+v", allocation)
+	}
+	if n.Network != mustParseNetwork("41.1.0.0/16") {
+		t.Errorf("records with a different date should not be compacted together but found %v", n.Network)
+	}
+	for _, address := range []string{"41.2.0.1", "41.3.0.1"} {
+		if _, precision := tree.LookupLayered(net.ParseIP(address)); precision != PrecisionRegion {
+			t.Errorf("%v should resolve to the registry region", address)
+		}
+		if n, _ := tree.LookupLayered(net.ParseIP(address), StatusReserved, StatusAvailable); n != nil {
+			t.Errorf("%v should have been excluded but resolved to %v", address, n.Network)
+		}
+	}
+	holder := tree.NetworksByOpaqueID(SourceAFRINIC, "F36B9F4B")
+	if len(holder) != 2 || holder[0].Network != mustParseNetwork("41.0.0.0/16") {
+		t.Errorf("unexpected networks for the holder: %v", holder)
+	}
+
+	recorder := httptest.NewRecorder()
+	newServeMux(tree).ServeHTTP(recorder, httptest.NewRequest("GET", "/lookup?ip=41.2.0.1&exclude=reserved", nil))
+	if recorder.Code != 404 {
+		t.Errorf("excluded network was returned by /lookup: %v", recorder.Body.String())
+	}
+	recorder = httptest.NewRecorder()
+	newServeMux(tree).ServeHTTP(recorder, httptest.NewRequest("GET", "/holder?registry=afrinic&id=F36B9F4B", nil))
+	if body := recorder.Body.String(); recorder.Code != 200 || !strings.Contains(body, "41.0.0.0/16") {
+		t.Errorf("unexpected /holder response: %v", body)
+	}
+	recorder = httptest.NewRecorder()
+	newServeMux(tree).ServeHTTP(recorder, httptest.NewRequest("GET", "/holder?id=F36B9F4B", nil))
+	if recorder.Code != 400 {
+		t.Errorf("/holder without a registry returned %v", recorder.Code)
+	}
+}
+
+func TestRangeNetworks(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	buf := subnetmath.NewBuffer()
+	for i := 0; i < 10000; i++ {
+		first := uint64(r.Uint32())
+		count := uint64(r.Int63n(1<<uint(r.Intn(24)+1))) + 1
+		if i%10 == 0 {
+			first &^= 0xff
+			count = 256 * uint64(r.Intn(16)+1)
+		}
+		if first+count > 1<<32 {
+			count = 1<<32 - first
+		}
+		start := make(net.IP, net.IPv4len)
+		binary.BigEndian.PutUint32(start, uint32(first))
+		networks, err := rangeNetworks(buf, start, count)
+		if err != nil {
+			t.Fatal(err)
+		}
+		next := first
+		for j, network := range networks {
+			if network.IsV6() || uint64(binary.BigEndian.Uint32(network.IP().To4())) != next {
+				t.Fatalf("%v does not start where the previous network ended in %v+%v", network, start, count)
+			}
+			next += 1 << uint(32-network.Ones())
+			if j > 0 {
+				if _, ok := networks[j-1].join(network); ok {
+					t.Fatalf("%v and %v should have been a single network", networks[j-1], network)
+				}
+			}
+		}
+		if next != first+count {
+			t.Fatalf("%v+%v was covered up to %v", start, count, next)
+		}
+	}
+	for _, count := range []uint64{0, 1 << 32} {
+		if _, err := rangeNetworks(buf, net.ParseIP("1.0.0.0"), count); err == nil {
+			t.Errorf("%v addresses from 1.0.0.0 should be rejected", count)
+		}
+	}
+	if networks, _ := rangeNetworks(buf, net.ParseIP("24.152.0.0"), 1280); len(networks) != 2 {
+		t.Errorf("1280 addresses should be covered by a /22 and a /24 but got %v", networks)
+	}
+}
+
+func TestDelegatedValidator(t *testing.T) {
+	header := "2.3|lacnic|20190106|2|19870101|20190104|-0200\n" +
+		"lacnic|*|asn|*|1|summary\n" +
+		"lacnic|*|ipv4|*|1|summary\n" +
+		"lacnic|*|ipv6|*|0|summary\n"
+	asn := "lacnic|BR|asn|1916|1|19930101|allocated|1\n"
+	ipv4 := "lacnic|BR|ipv4|10.0.0.0|256|19970602|allocated|1\n"
+	for _, test := range []struct {
+		contents string
+		valid    bool
+	}{
+		{header + asn + ipv4, true},
+		{"# comment\n" + header + asn + "\n" + ipv4, true},
+		{header + asn, false},
+		{header + asn + ipv4 + ipv4, false},
+		{strings.Replace(header, "|2|", "|3|", 1) + asn + ipv4, false},
+		{header + asn + strings.Replace(ipv4, "19970602", "20190107", 1), false},
+		{header + asn + strings.Replace(ipv4, "lacnic|BR", "arin|BR", 1), false},
+		{strings.Replace(header, "20190106", "2019-01-06", 1) + asn + ipv4, false},
+		{strings.Replace(header, "lacnic|2019", "nic|2019", 1) + asn + ipv4, false},
+		{"", false},
+	} {
+		validator := &delegatedValidator{}
+		var err error
+		for _, line := range strings.Split(strings.TrimSuffix(test.contents, "\n"), "\n") {
+			if _, err = validator.check(strings.Split(line, "|")); err != nil {
+				break
+			}
+		}
+		if err == nil {
+			err = validator.finish()
+		}
+		if (err == nil) != test.valid {
+			t.Errorf("validation of %q returned %v", test.contents, err)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+func serveCommand(args []string) {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := flags.String("addr", ":8080", "address to listen on")
+	treeFile := treeFlag(flags)
+	overrides := flags.String("overrides", "", "csv, json or yaml file of overrides that is reloaded on SIGHUP")
+	cacheSize := flags.Int("cache", 0, "number of addresses whose lookups are cached, 0 disables the cache")
+	parseFlags(flags, args)
+	tree := loadTree(*treeFile)
+	tree.EnableCache(*cacheSize)
+	mux := newServeMux(tree)
+	var handler http.Handler = mux
+	if *overrides != "" {
+		if err := tree.ReloadOverrides(*overrides); err != nil {
+			fatalf("unable to load overrides because: %v", err)
+		}
+		// overrides change the tree so requests are held back while they are reloaded
+		mtx := &sync.RWMutex{}
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mtx.RLock()
+			defer mtx.RUnlock()
+			mux.ServeHTTP(w, r)
+		})
+		reloadOnHangup(tree, *overrides, mtx)
+	}
+	log.Printf("listening on %v", *addr)
+	fatalf("unable to serve because: %v", http.ListenAndServe(*addr, handler))
+}
+
+// reloadOnHangup swaps in the overrides file again whenever the process receives SIGHUP
+func reloadOnHangup(tree *Tree, filename string, mtx *sync.RWMutex) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+	go func() {
+		for range c {
+			overrides, err := LoadOverrides(filename)
+			if err != nil {
+				log.Printf("keeping the previous overrides because: %v", err)
+				continue
+			}
+			mtx.Lock()
+			tree.SetOverrides(overrides)
+			mtx.Unlock()
+			log.Printf("reloaded overrides from %v", filename)
+		}
+	}()
+}
+
+func newServeMux(tree *Tree) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/near", func(w http.ResponseWriter, r *http.Request) {
+		var values [3]float64
+		for i, key := range []string{"lat", "lon", "km"} {
+			value, err := strconv.ParseFloat(r.URL.Query().Get(key), 64)
+			if err != nil {
+				http.Error(w, "query parameter '"+key+"' is not a valid number", http.StatusBadRequest)
+				return
+			}
+			values[i] = value
+		}
+		type nearJSON struct {
+			nodeJSON
+			DistanceKm float64 `json:"distanceKm"`
+		}
+		nodes, err := tree.NetworksNear(values[0], values[1], values[2])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		result := []nearJSON{}
+		for _, n := range nodes {
+			result = append(result, nearJSON{summarizeJSON(n),
+				haversine(values[0], values[1], n.GeoPosition.Latitude, n.GeoPosition.Longitude)})
+		}
+		writeJSON(w, result)
+	})
+	mux.HandleFunc("/lookup", func(w http.ResponseWriter, r *http.Request) {
+		exclude, err := parseStatuses(r.URL.Query().Get("exclude"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		enabled, err := parseTransformations(r.URL.Query().Get("normalize"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		address, transformation := ParseAddress(r.URL.Query().Get("ip"), enabled...)
+		if address == nil {
+			http.Error(w, "query parameter 'ip' is not a valid address", http.StatusBadRequest)
+			return
+		}
+		result, found := tree.lookupJSON(address, transformation, exclude)
+		if !found {
+			http.Error(w, "no position is known for "+address.String(), http.StatusNotFound)
+			return
+		}
+		writeJSON(w, result)
+	})
+	mux.HandleFunc("/holder", func(w http.ResponseWriter, r *http.Request) {
+		registry, found := registrySources[strings.ToLower(r.URL.Query().Get("registry"))]
+		if !found {
+			http.Error(w, "query parameter 'registry' is not arin, ripencc, apnic, afrinic or lacnic", http.StatusBadRequest)
+			return
+		}
+		result := []string{}
+		for _, n := range tree.NetworksByOpaqueID(registry, r.URL.Query().Get("id")) {
+			result = append(result, n.Network.String())
+		}
+		writeJSON(w, result)
+	})
+	mux.HandleFunc("/asn", func(w http.ResponseWriter, r *http.Request) {
+		asn, err := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(r.URL.Query().Get("n")), "AS"), 10, 32)
+		if err != nil {
+			http.Error(w, "query parameter 'n' is not a valid AS number", http.StatusBadRequest)
+			return
+		}
+		record, found := tree.LookupASN(uint32(asn))
+		if !found {
+			http.Error(w, "AS"+strconv.FormatUint(asn, 10)+" has not been delegated", http.StatusNotFound)
+			return
+		}
+		networks := []string{}
+		for _, n := range tree.NetworksByASN(uint32(asn)) {
+			networks = append(networks, n.Network.String())
+		}
+		writeJSON(w, struct {
+			ASNRecord
+			Networks []string `json:"networks"`
+		}{record, networks})
+	})
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		status := struct {
+			Metadata
+			Networks int         `json:"networks"`
+			Cache    *CacheStats `json:"cache,omitempty"`
+		}{Metadata: tree.Metadata, Networks: tree.Size}
+		if stats, enabled := tree.CacheStats(); enabled {
+			status.Cache = &stats
+		}
+		writeJSON(w, status)
+	})
+	mux.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, tree.Stats())
+	})
+	return mux
+}
+
+// lookupJSON describes the answer to a /lookup query, which has no position inside
+// private and bogon special-purpose ranges
+type lookupJSON struct {
+	Address string `json:"address"` // after normalization
+	*nodeJSON
+	Source         Source          `json:"source"`
+	Precision      PrecisionLevel  `json:"precision"`
+	Allocation     *Allocation     `json:"allocation,omitempty"`
+	Special        *SpecialPurpose `json:"special,omitempty"`
+	Note           string          `json:"note,omitempty"` // only set inside an override
+	Transformation Transformation  `json:"transformation"`
+}
+
+// lookupJSON answers a lookup for the address and reports whether anything is known about it
+func (tree *Tree) lookupJSON(address net.IP, transformation Transformation, exclude []AllocationStatus) (lookupJSON, bool) {
+	n, precision := tree.LookupLayered(address, exclude...)
+	result := lookupJSON{
+		Address:        address.String(),
+		Precision:      precision,
+		Special:        tree.LookupSpecial(address),
+		Transformation: transformation,
+	}
+	if n != nil {
+		summary := summarizeJSON(n)
+		result.nodeJSON = &summary
+		result.Source = n.GeoPosition.Source
+		result.Allocation = n.GeoPosition.Allocation
+		if override := tree.LookupOverride(address); override != nil {
+			result.Note = override.Note
+		}
+	}
+	return result, n != nil || result.Special != nil
+}
+
+// parseStatuses parses a comma separated list of allocation statuses
+func parseStatuses(s string) ([]AllocationStatus, error) {
+	var statuses []AllocationStatus
+	if s == "" {
+		return nil, nil
+	}
+	for _, name := range strings.Split(s, ",") {
+		status := parseAllocationStatus(name)
+		if status == StatusUnknown {
+			return nil, errors.New("'" + name + "' is not a valid allocation status")
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// parseTransformations parses a comma separated list of transformations
+func parseTransformations(s string) ([]Transformation, error) {
+	var transformations []Transformation
+	if s == "" {
+		return nil, nil
+	}
+	for _, name := range strings.Split(s, ",") {
+		transformation := parseTransformation(name)
+		if transformation == TransformNone {
+			return nil, errors.New("'" + name + "' is not a valid transformation")
+		}
+		transformations = append(transformations, transformation)
+	}
+	return transformations, nil
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("unable to write response because: %v", err)
+	}
+}
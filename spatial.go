@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// spatialCell is a one degree square of latitude and longitude
+type spatialCell struct {
+	latitude, longitude int
+}
+
+type spatialIndex struct {
+	cells map[spatialCell][]*Node
+}
+
+func newSpatialIndex(tree *Tree) *spatialIndex {
+	index := &spatialIndex{cells: map[spatialCell][]*Node{}}
+	var walk func(nodes []*Node)
+	walk = func(nodes []*Node) {
+		for _, n := range nodes {
+			if n.GeoPosition != nil {
+				cell := cellOf(n.GeoPosition.Latitude, n.GeoPosition.Longitude)
+				index.cells[cell] = append(index.cells[cell], n)
+			}
+			walk(n.Children)
+		}
+	}
+	walk(tree.Roots)
+	walk(tree.RootsV6)
+	return index
+}
+
+func cellOf(latitude, longitude float64) spatialCell {
+	cellLatitude := int(math.Floor(latitude))
+	if cellLatitude > 89 {
+		cellLatitude = 89
+	} else if cellLatitude < -90 {
+		cellLatitude = -90
+	}
+	return spatialCell{cellLatitude, wrapLongitude(int(math.Floor(longitude)))}
+}
+
+func wrapLongitude(longitude int) int {
+	return ((longitude+180)%360+360)%360 - 180
+}
+
+// NetworksNear returns every populated network positioned within km of the point ordered by distance
+func (tree *Tree) NetworksNear(latitude, longitude, km float64) ([]*Node, error) {
+	if math.IsNaN(latitude) || latitude < -90 || latitude > 90 {
+		return nil, fmt.Errorf("latitude %v is not between -90 and 90", latitude)
+	}
+	if math.IsNaN(longitude) || longitude < -180 || longitude > 180 {
+		return nil, fmt.Errorf("longitude %v is not between -180 and 180", longitude)
+	}
+	if math.IsNaN(km) || math.IsInf(km, 0) || km < 0 {
+		return nil, fmt.Errorf("distance %v is not a finite number of km", km)
+	}
+	tree.mtx.Lock()
+	if tree.spatial == nil {
+		tree.spatial = newSpatialIndex(tree)
+	}
+	index := tree.spatial
+	tree.mtx.Unlock()
+	return index.near(latitude, longitude, km), nil
+}
+
+func (index *spatialIndex) near(latitude, longitude, km float64) []*Node {
+	var result []*Node
+	distances := map[*Node]float64{}
+	// bounding box from http://janmatuschek.de/LatitudeLongitudeBoundingCoordinates
+	// no point is further away than the antipode
+	angularDistance := math.Min(km/earthRadiusKm, math.Pi)
+	minCell := cellOf(latitude-angularDistance*180/math.Pi, 0).latitude
+	maxCell := cellOf(latitude+angularDistance*180/math.Pi, 0).latitude
+	minLongitude, maxLongitude := -180, 179
+	if angularDistance < math.Pi/2-math.Abs(latitude*math.Pi/180) {
+		longitudeSpan := math.Asin(math.Sin(angularDistance)/math.Cos(latitude*math.Pi/180)) * 180 / math.Pi
+		minLongitude = int(math.Floor(longitude - longitudeSpan))
+		maxLongitude = int(math.Floor(longitude + longitudeSpan))
+		if maxLongitude-minLongitude >= 360 {
+			minLongitude, maxLongitude = -180, 179
+		}
+	}
+	for cellLatitude := minCell; cellLatitude <= maxCell; cellLatitude++ {
+		for cellLongitude := minLongitude; cellLongitude <= maxLongitude; cellLongitude++ {
+			for _, n := range index.cells[spatialCell{cellLatitude, wrapLongitude(cellLongitude)}] {
+				distance := haversine(latitude, longitude, n.GeoPosition.Latitude, n.GeoPosition.Longitude)
+				if distance <= km {
+					distances[n] = distance
+					result = append(result, n)
+				}
+			}
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if distances[result[i]] != distances[result[j]] {
+			return distances[result[i]] < distances[result[j]]
+		}
+		return result[i].Network.Before(result[j].Network)
+	})
+	return result
+}
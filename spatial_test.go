@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNetworksNear(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	tree := NewTree(16)
+	for i := 0; i < 5000; i++ {
+		position := &GeoPosition{Latitude: r.Float64()*180 - 90, Longitude: r.Float64()*360 - 180}
+		tree.insert(position, mustParseNetwork(fmt.Sprintf("10.%v.%v.0/24", i/256, i%256)))
+	}
+	tree.insert(&GeoPosition{Latitude: -48.85, Longitude: -177.65}, mustParseNetwork("192.0.2.0/24"))
+	all := tree.Covered(mustParseNetwork("0.0.0.0/0").IPNet())
+	for _, query := range [][3]float64{{0, 0, 500}, {48.85, 2.35, 2000}, {-33.9, 151.2, 4000},
+		{89.5, 10, 300}, {-80, 179.9, 1500}, {10, -179.5, 800}, {0, 0, 20000}, {48.85, 2.35, 1e9}} {
+		expected := 0
+		for _, n := range all {
+			if haversine(query[0], query[1], n.GeoPosition.Latitude, n.GeoPosition.Longitude) <= query[2] {
+				expected++
+			}
+		}
+		result, err := tree.NetworksNear(query[0], query[1], query[2])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result) != expected {
+			t.Errorf("%v returned %v networks instead of %v", query, len(result), expected)
+		}
+		for i := 1; i < len(result); i++ {
+			if haversine(query[0], query[1], result[i].GeoPosition.Latitude, result[i].GeoPosition.Longitude) <
+				haversine(query[0], query[1], result[i-1].GeoPosition.Latitude, result[i-1].GeoPosition.Longitude) {
+				t.Fatalf("%v results are not ordered by distance", query)
+			}
+		}
+	}
+}
+
+func TestNetworksNearRejectsInvalidInput(t *testing.T) {
+	tree := NewTree(16)
+	tree.insert(&GeoPosition{Latitude: 48.85, Longitude: 2.35}, mustParseNetwork("192.0.2.0/24"))
+	for _, query := range [][3]float64{{0, 0, math.Inf(1)}, {0, 0, math.NaN()}, {0, 0, -1},
+		{90.5, 0, 100}, {math.NaN(), 0, 100}, {0, -181, 100}, {0, math.Inf(-1), 100}} {
+		if _, err := tree.NetworksNear(query[0], query[1], query[2]); err == nil {
+			t.Errorf("%v was accepted", query)
+		}
+	}
+}
+
+func TestNearHandler(t *testing.T) {
+	tree := NewTree(16)
+	tree.insert(&GeoPosition{Latitude: 48.85, Longitude: 2.35}, mustParseNetwork("192.0.2.0/24"))
+	tree.insert(&GeoPosition{Latitude: 51.5, Longitude: -0.12}, mustParseNetwork("198.51.100.0/24"))
+	recorder := httptest.NewRecorder()
+	newServeMux(tree).ServeHTTP(recorder, httptest.NewRequest("GET", "/near?lat=48.8&lon=2.3&km=100", nil))
+	var result []struct {
+		Network    string  `json:"network"`
+		DistanceKm float64 `json:"distanceKm"`
+	}
+	if err := json.NewDecoder(recorder.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 1 || result[0].Network != "192.0.2.0/24" || result[0].DistanceKm > 10 {
+		t.Error("unexpected response", result)
+	}
+	recorder = httptest.NewRecorder()
+	newServeMux(tree).ServeHTTP(recorder, httptest.NewRequest("GET", "/near?lat=48.8&lon=2.3", nil))
+	if recorder.Code != 400 {
+		t.Error("a missing radius returned status", recorder.Code)
+	}
+	for _, query := range []string{"lat=48.8&lon=2.3&km=Inf", "lat=48.8&lon=2.3&km=-5", "lat=91&lon=2.3&km=100",
+		"lat=48.8&lon=200&km=100", "lat=NaN&lon=2.3&km=100"} {
+		recorder = httptest.NewRecorder()
+		newServeMux(tree).ServeHTTP(recorder, httptest.NewRequest("GET", "/near?"+query, nil))
+		if recorder.Code != 400 {
+			t.Errorf("%v returned status %v", query, recorder.Code)
+		}
+	}
+}
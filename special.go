@@ -0,0 +1,157 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// AddressClass describes why an address is not an ordinary public address
+type AddressClass uint8
+
+const (
+	ClassReserved AddressClass = iota // set aside by the IETF but reachable, such as 6to4 or AS112
+	ClassPrivate                      // routed inside an organisation, such as RFC 1918 or CGNAT
+	ClassBogon                        // never seen on the public internet, such as loopback or documentation
+)
+
+var addressClassNames = []string{"reserved", "private", "bogon"}
+
+func (c AddressClass) String() string {
+	if int(c) < len(addressClassNames) {
+		return addressClassNames[c]
+	}
+	return addressClassNames[ClassReserved]
+}
+
+// MarshalText encodes the AddressClass by name
+func (c AddressClass) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// SpecialPurpose is an entry of the IANA special-purpose registries or a range added by the caller
+type SpecialPurpose struct {
+	Network           Network      `json:"network"`
+	Name              string       `json:"name"`
+	RFC               string       `json:"rfc,omitempty"`
+	Class             AddressClass `json:"class"`
+	Forwardable       bool         `json:"forwardable"`
+	GloballyReachable bool         `json:"globallyReachable"`
+	GeoPosition       *GeoPosition `json:"geoPosition,omitempty"` // only set on ranges added by the caller
+}
+
+// https://www.iana.org/assignments/iana-ipv4-special-registry/
+//
+//go:embed inputdata/iana-ipv4-special-registry-1.csv
+var ianaIPv4SpecialRegistry string
+
+// https://www.iana.org/assignments/iana-ipv6-special-registry/
+//
+//go:embed inputdata/iana-ipv6-special-registry-1.csv
+var ianaIPv6SpecialRegistry string
+
+var privateUseNames = map[string]bool{"Private-Use": true, "Shared Address Space": true, "Unique-Local": true}
+
+var (
+	ianaSpecialPurposeOnce sync.Once
+	ianaSpecialPurpose     []*SpecialPurpose
+)
+
+// builtinSpecialPurpose parses the embedded IANA registries the first time they are needed
+func builtinSpecialPurpose() []*SpecialPurpose {
+	ianaSpecialPurposeOnce.Do(func() {
+		for _, registry := range []string{ianaIPv4SpecialRegistry, ianaIPv6SpecialRegistry} {
+			entries, err := parseSpecialRegistry(strings.NewReader(registry))
+			if err != nil {
+				panic(err)
+			}
+			ianaSpecialPurpose = append(ianaSpecialPurpose, entries...)
+		}
+	})
+	return ianaSpecialPurpose
+}
+
+var footnote = regexp.MustCompile(`\s*\[\d+\]`)
+
+// parseSpecialRegistry reads a special-purpose registry in the CSV format published by IANA
+func parseSpecialRegistry(r io.Reader) ([]*SpecialPurpose, error) {
+	reader := csv.NewReader(r)
+	reader.Read() // skip the first line
+	var result []*SpecialPurpose
+	for {
+		lineColumns, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if len(lineColumns) < 10 {
+			return nil, fmt.Errorf("'%v' has %v columns instead of 10", lineColumns[0], len(lineColumns))
+		}
+		name := lineColumns[1]
+		isTrue := func(column string) bool { return strings.HasPrefix(column, "True") }
+		class := ClassReserved
+		if privateUseNames[name] {
+			class = ClassPrivate
+		} else if strings.HasPrefix(lineColumns[8], "False") {
+			class = ClassBogon
+		}
+		for _, block := range strings.Split(footnote.ReplaceAllString(lineColumns[0], ""), ",") {
+			network, err := ParseNetwork(strings.TrimSpace(block))
+			if err != nil {
+				return nil, err
+			} else if strings.Contains(block, ":") && !network.IsV6() {
+				continue // IPv4-mapped addresses are looked up as IPv4
+			}
+			result = append(result, &SpecialPurpose{
+				Network:           network,
+				Name:              name,
+				RFC:               strings.Join(strings.Fields(lineColumns[2]), " "),
+				Class:             class,
+				Forwardable:       isTrue(lineColumns[7]),
+				GloballyReachable: isTrue(lineColumns[8]),
+			})
+		}
+	}
+	return result, nil
+}
+
+func newSpecialRegistry() *prefixIndex[*SpecialPurpose] {
+	registry := newPrefixIndex[*SpecialPurpose]()
+	for _, special := range builtinSpecialPurpose() {
+		registry.add(special.Network, special)
+	}
+	return registry
+}
+
+// AddSpecialPurpose registers an internal range, replacing any entry for the same network.
+// Lookups inside it return the GeoPosition, which may be nil, instead of any ingested data.
+func (tree *Tree) AddSpecialPurpose(network Network, name string, class AddressClass, geoPosition *GeoPosition) {
+	tree.mtx.Lock()
+	defer tree.mtx.Unlock()
+	tree.special.add(network, &SpecialPurpose{
+		Network:     network,
+		Name:        name,
+		Class:       class,
+		Forwardable: true,
+		GeoPosition: geoPosition,
+	})
+	tree.purgeCache()
+}
+
+// LookupSpecial returns the most specific special-purpose range that contains the address
+func (tree *Tree) LookupSpecial(address net.IP) *SpecialPurpose {
+	host, ok := NetworkFromIP(address)
+	if !ok {
+		return nil
+	}
+	tree.mtx.RLock()
+	defer tree.mtx.RUnlock()
+	special, _ := tree.special.lookup(host)
+	return special
+}
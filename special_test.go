@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLookupSpecial(t *testing.T) {
+	tree := NewTree(16)
+	for _, test := range []struct {
+		address string
+		network string
+		class   AddressClass
+	}{
+		{"10.1.2.3", "10.0.0.0/8", ClassPrivate},
+		{"100.64.0.1", "100.64.0.0/10", ClassPrivate},
+		{"127.0.0.1", "127.0.0.0/8", ClassBogon},
+		{"169.254.1.1", "169.254.0.0/16", ClassBogon},
+		{"192.0.2.1", "192.0.2.0/24", ClassBogon},
+		{"192.0.0.9", "192.0.0.9/32", ClassReserved},
+		{"192.0.0.171", "192.0.0.171/32", ClassBogon},
+		{"192.88.99.1", "192.88.99.0/24", ClassReserved},
+		{"255.255.255.255", "255.255.255.255/32", ClassBogon},
+		{"fd00::1", "fc00::/7", ClassPrivate},
+		{"fe80::1", "fe80::/10", ClassBogon},
+		{"::1", "::1/128", ClassBogon},
+		{"2001:db8::1", "2001:db8::/32", ClassBogon},
+		{"2001:0:4136:e378::1", "2001::/32", ClassReserved},
+		{"2001:1ff::1", "2001::/23", ClassBogon},
+		{"2002::1", "2002::/16", ClassReserved},
+	} {
+		special := tree.LookupSpecial(net.ParseIP(test.address))
+		if special == nil || special.Network != mustParseNetwork(test.network) || special.Class != test.class {
+			t.Errorf("%v resolved to %+v instead of %v as %v", test.address, special, test.network, test.class)
+		}
+	}
+	for _, address := range []string{"8.8.8.8", "::ffff:8.8.8.8", "2a00::1"} {
+		if special := tree.LookupSpecial(net.ParseIP(address)); special != nil {
+			t.Errorf("%v is not special-purpose but resolved to %+v", address, special)
+		}
+	}
+	if special := tree.LookupSpecial(net.ParseIP("192.0.0.170")); special.RFC != "[RFC8880][RFC7050], Section 2.2" {
+		t.Errorf("unexpected RFC %q", special.RFC)
+	}
+}
+
+func TestSpecialPurposeLayering(t *testing.T) {
+	tree := NewTree(16)
+	tree.insert(&GeoPosition{Location: &GeoLocation{CountryISO: "US"}}, mustParseNetwork("0.0.0.0/1"))
+	tree.insert(&GeoPosition{Location: &GeoLocation{CountryISO: "DE"}}, mustParseNetwork("2002::/16"))
+	office := &GeoPosition{Latitude: 52.52, Longitude: 13.4, Location: &GeoLocation{CityName: "Berlin", CountryISO: "DE"}}
+	tree.AddSpecialPurpose(mustParseNetwork("10.20.0.0/16"), "Berlin office", ClassPrivate, office)
+
+	if n, precision := tree.LookupLayered(net.ParseIP("10.1.2.3")); n != nil || precision != PrecisionNone {
+		t.Errorf("private address resolved to %v", n)
+	}
+	if n, precision := tree.LookupLayered(net.ParseIP("10.20.1.1")); n == nil || n.GeoPosition != office ||
+		n.Network != mustParseNetwork("10.20.0.0/16") || precision != PrecisionCity {
+		t.Errorf("office address resolved to %v with %v", n, precision)
+	}
+	if special := tree.LookupSpecial(net.ParseIP("10.20.1.1")); special.Name != "Berlin office" {
+		t.Errorf("the most specific range was not returned: %+v", special)
+	}
+	if n, _ := tree.LookupLayered(net.ParseIP("2002::1")); n == nil {
+		t.Error("reserved ranges that are globally reachable should still resolve")
+	}
+	if NewTree(16).LookupSpecial(net.ParseIP("10.20.1.1")).Name != "Private-Use" {
+		t.Error("ranges added to one tree leaked into another")
+	}
+
+	recorder := httptest.NewRecorder()
+	newServeMux(tree).ServeHTTP(recorder, httptest.NewRequest("GET", "/lookup?ip=127.0.0.1", nil))
+	var result struct {
+		Network   string `json:"network"`
+		Precision string `json:"precision"`
+		Special   *struct {
+			Class string `json:"class"`
+		} `json:"special"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if recorder.Code != 200 || result.Network != "" || result.Precision != "none" || result.Special == nil ||
+		result.Special.Class != "bogon" {
+		t.Errorf("unexpected /lookup response: %v", recorder.Body.String())
+	}
+}
+
+func TestParseSpecialRegistry(t *testing.T) {
+	if _, err := parseSpecialRegistry(strings.NewReader("header\n10.0.0.0/8,Private-Use\n")); err == nil {
+		t.Error("short rows should be rejected")
+	}
+	if _, err := parseSpecialRegistry(strings.NewReader("header\nbogus,a,b,c,d,e,f,g,h,i\n")); err == nil {
+		t.Error("invalid address blocks should be rejected")
+	}
+}
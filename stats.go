@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+)
+
+// Stats summarises the coverage and the shape of a Tree
+type Stats struct {
+	Countries map[string]*CoverageStats `json:"countries"` // keyed by ISO code, empty when unknown
+	Sources   map[string]*CoverageStats `json:"sources"`
+
+	CityLevel    SpaceStats `json:"cityLevel"`
+	CountryLevel SpaceStats `json:"countryLevel"`
+	NoPosition   SpaceStats `json:"noPosition"`
+
+	Nodes          int     `json:"nodes"`
+	SyntheticNodes int     `json:"syntheticNodes"`
+	DepthHistogram []int   `json:"depthHistogram"` // number of nodes found at each depth
+	Precision      int     `json:"precision"`
+	MaxFanOut      int     `json:"maxFanOut"`
+	MeanFanOut     float64 `json:"meanFanOut"`
+	OverPrecision  int     `json:"overPrecision"` // nodes with more children than Precision
+}
+
+// CoverageStats counts the networks and address space that resolve to a country or source
+type CoverageStats struct {
+	Networks      int     `json:"networks"`
+	IPv4Addresses uint64  `json:"ipv4Addresses"`
+	IPv6Slash48s  float64 `json:"ipv6Slash48s"`
+}
+
+// SpaceStats holds the percentage of each address family that falls into a category
+type SpaceStats struct {
+	IPv4Percent float64 `json:"ipv4Percent"`
+	IPv6Percent float64 `json:"ipv6Percent"`
+}
+
+// Stats walks the whole Tree and attributes the address space of every node that is not
+// covered by one of its children to the closest populated GeoPosition. The registry layer is
+// attributed the address space that only it gives a position to, as LookupLayered does.
+func (tree *Tree) Stats() *Stats {
+	stats := &Stats{
+		Countries: map[string]*CoverageStats{},
+		Sources:   map[string]*CoverageStats{},
+		Precision: tree.Precision,
+	}
+	var cityLevel, countryLevel [2]float64
+	var internalNodes, totalChildren int
+	attribute := func(n *Node, geoPosition *GeoPosition, ownSpace float64) {
+		country := ""
+		if geoPosition.Location != nil {
+			country = geoPosition.Location.CountryISO
+		}
+		for _, coverage := range []*CoverageStats{
+			stats.coverage(stats.Countries, country),
+			stats.coverage(stats.Sources, geoPosition.Source.String()),
+		} {
+			if n.GeoPosition != nil {
+				coverage.Networks++
+			}
+			if n.Network.IsV6() {
+				coverage.IPv6Slash48s += ownSpace
+			} else {
+				coverage.IPv4Addresses += uint64(ownSpace)
+			}
+		}
+		family := 0
+		if n.Network.IsV6() {
+			family = 1
+		}
+		if geoPosition.Location != nil && geoPosition.Location.CityName != "" {
+			cityLevel[family] += ownSpace
+		} else {
+			countryLevel[family] += ownSpace
+		}
+	}
+	var walk func(nodes []*Node, inherited *GeoPosition, depth int)
+	walk = func(nodes []*Node, inherited *GeoPosition, depth int) {
+		for _, n := range nodes {
+			stats.Nodes++
+			if len(stats.DepthHistogram) <= depth {
+				stats.DepthHistogram = append(stats.DepthHistogram, 0)
+			}
+			stats.DepthHistogram[depth]++
+			if len(n.Children) > 0 {
+				internalNodes++
+				totalChildren += len(n.Children)
+			}
+			if len(n.Children) > stats.MaxFanOut {
+				stats.MaxFanOut = len(n.Children)
+			}
+			if len(n.Children) > tree.Precision {
+				stats.OverPrecision++
+			}
+			geoPosition := n.GeoPosition
+			if geoPosition == nil {
+				stats.SyntheticNodes++
+				geoPosition = inherited
+			}
+			ownSpace := addressSpace(n.Network)
+			for _, child := range n.Children {
+				ownSpace -= addressSpace(child.Network)
+			}
+			if geoPosition != nil {
+				attribute(n, geoPosition, ownSpace)
+			}
+			walk(n.Children, geoPosition, depth+1)
+		}
+	}
+	walk(tree.Roots, nil, 0)
+	walk(tree.RootsV6, nil, 0)
+	var walkRegistry func(nodes []*Node, inherited *GeoPosition)
+	walkRegistry = func(nodes []*Node, inherited *GeoPosition) {
+		for _, n := range nodes {
+			geoPosition := n.GeoPosition
+			if geoPosition == nil {
+				geoPosition = inherited
+			}
+			ownSpace := addressSpace(n.Network) - tree.positionedSpace(n.Network)
+			for _, child := range n.Children {
+				ownSpace -= addressSpace(child.Network) - tree.positionedSpace(child.Network)
+			}
+			if geoPosition != nil {
+				attribute(n, geoPosition, ownSpace)
+			}
+			walkRegistry(n.Children, geoPosition)
+		}
+	}
+	if tree.Registry != nil {
+		walkRegistry(tree.Registry.Roots, nil)
+		walkRegistry(tree.Registry.RootsV6, nil)
+	}
+	if internalNodes > 0 {
+		stats.MeanFanOut = float64(totalChildren) / float64(internalNodes)
+	}
+	totals := [2]float64{math.Ldexp(1, 32), math.Ldexp(1, 48)}
+	for family, percent := range []*float64{&stats.CityLevel.IPv4Percent, &stats.CityLevel.IPv6Percent} {
+		*percent = 100 * cityLevel[family] / totals[family]
+	}
+	for family, percent := range []*float64{&stats.CountryLevel.IPv4Percent, &stats.CountryLevel.IPv6Percent} {
+		*percent = 100 * countryLevel[family] / totals[family]
+	}
+	stats.NoPosition.IPv4Percent = 100 - stats.CityLevel.IPv4Percent - stats.CountryLevel.IPv4Percent
+	stats.NoPosition.IPv6Percent = 100 - stats.CityLevel.IPv6Percent - stats.CountryLevel.IPv6Percent
+	return stats
+}
+
+// positionedSpace returns the address space within the network that resolves to a position of the tree
+func (tree *Tree) positionedSpace(network Network) float64 {
+	for n := tree.lookupTrie().findClosestSupernet(network); n != nil; n = n.Parent {
+		if n.GeoPosition != nil {
+			return addressSpace(network)
+		}
+	}
+	var sum func(nodes []*Node) float64
+	sum = func(nodes []*Node) float64 {
+		total := 0.0
+		for _, n := range nodes {
+			if network.Contains(n.Network) && n.GeoPosition != nil {
+				total += addressSpace(n.Network)
+			} else if network.Contains(n.Network) || n.Network.Contains(network) {
+				total += sum(n.Children)
+			}
+		}
+		return total
+	}
+	if network.IsV6() {
+		return sum(tree.RootsV6)
+	}
+	return sum(tree.Roots)
+}
+
+func (stats *Stats) coverage(m map[string]*CoverageStats, key string) *CoverageStats {
+	if m[key] == nil {
+		m[key] = &CoverageStats{}
+	}
+	return m[key]
+}
+
+// addressSpace counts IPv4 networks in addresses and IPv6 networks in /48 equivalents
+func addressSpace(network Network) float64 {
+	if network.IsV6() {
+		return math.Ldexp(1, 48-network.Ones())
+	}
+	return math.Ldexp(1, 32-network.Ones())
+}
+
+func statsCommand(args []string) {
+	flags := flag.NewFlagSet("stats", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print the statistics as JSON")
+	treeFile := treeFlag(flags)
+	parseFlags(flags, args)
+	stats := loadTree(*treeFile).Stats()
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(stats); err != nil {
+			fatalf("unable to print stats because: %v", err)
+		}
+		return
+	}
+	stats.write(os.Stdout)
+}
+
+func (stats *Stats) write(w io.Writer) {
+	fmt.Fprintf(w, "nodes: %v  synthetic: %v  precision: %v  max fan-out: %v  mean fan-out: %.2f  over precision: %v\n",
+		stats.Nodes, stats.SyntheticNodes, stats.Precision, stats.MaxFanOut, stats.MeanFanOut, stats.OverPrecision)
+	fmt.Fprintf(w, "depth histogram: %v\n", stats.DepthHistogram)
+	for _, level := range []struct {
+		name  string
+		space SpaceStats
+	}{{"city level", stats.CityLevel}, {"country level", stats.CountryLevel}, {"no position", stats.NoPosition}} {
+		fmt.Fprintf(w, "%-14v IPv4 %6.2f%%  IPv6 %6.2f%%\n", level.name+":", level.space.IPv4Percent, level.space.IPv6Percent)
+	}
+	for _, group := range []struct {
+		name     string
+		coverage map[string]*CoverageStats
+	}{{"source", stats.Sources}, {"country", stats.Countries}} {
+		var keys []string
+		for key := range group.coverage {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			a, b := group.coverage[keys[i]], group.coverage[keys[j]]
+			if a.IPv4Addresses != b.IPv4Addresses {
+				return a.IPv4Addresses > b.IPv4Addresses
+			}
+			return keys[i] < keys[j]
+		})
+		fmt.Fprintf(w, "\n%-16v %10v %14v %16v\n", group.name, "networks", "ipv4 addresses", "ipv6 /48s")
+		for _, key := range keys {
+			coverage := group.coverage[key]
+			if key == "" {
+				key = "unknown"
+			}
+			fmt.Fprintf(w, "%-16v %10v %14v %16.0f\n", key, coverage.Networks, coverage.IPv4Addresses, coverage.IPv6Slash48s)
+		}
+	}
+}
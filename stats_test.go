@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	paris := &GeoPosition{Location: &GeoLocation{CityName: "Paris", CountryISO: "FR"}, Source: SourceGeoLite}
+	france := &GeoPosition{Location: &GeoLocation{CountryISO: "FR"}, Source: SourceGeoLite}
+	brazil := &GeoPosition{Location: &GeoLocation{CountryISO: "BR"}}
+	tree := NewTree(2)
+	tree.insert(france, mustParseNetwork("10.0.0.0/8"))
+	tree.insert(paris, mustParseNetwork("10.0.0.0/16"), mustParseNetwork("10.1.0.0/16"), mustParseNetwork("10.2.0.0/16"))
+	tree.insert(brazil, mustParseNetwork("2001:db8::/32"))
+	stats := tree.Stats()
+
+	if fr := stats.Countries["FR"]; fr == nil || fr.Networks != 4 || fr.IPv4Addresses != 1<<24 {
+		t.Errorf("unexpected coverage for FR: %+v", fr)
+	}
+	if br := stats.Countries["BR"]; br == nil || br.Networks != 1 || br.IPv6Slash48s != 1<<16 {
+		t.Errorf("unexpected coverage for BR: %+v", br)
+	}
+	if geolite := stats.Sources["geolite2-city"]; geolite == nil || geolite.Networks != 4 {
+		t.Errorf("unexpected coverage for the geolite source: %+v", geolite)
+	}
+	if stats.Sources["unknown"] == nil {
+		t.Error("networks without a source were not counted")
+	}
+	if got, want := stats.CityLevel.IPv4Percent, 100*float64(3<<16)/(1<<32); got != want {
+		t.Errorf("city level IPv4 was %v%% instead of %v%%", got, want)
+	}
+	if got, want := stats.CountryLevel.IPv4Percent, 100*float64(1<<24-3<<16)/(1<<32); got != want {
+		t.Errorf("country level IPv4 was %v%% instead of %v%%", got, want)
+	}
+	if stats.NoPosition.IPv6Percent >= 100 || stats.CountryLevel.IPv6Percent <= 0 {
+		t.Errorf("unexpected IPv6 split: %+v %+v", stats.CountryLevel, stats.NoPosition)
+	}
+	if stats.SyntheticNodes == 0 || stats.MaxFanOut > tree.Precision || stats.OverPrecision != 0 {
+		t.Errorf("three children with a precision of two should create a synthetic node: %+v", stats)
+	}
+	total := 0
+	for _, count := range stats.DepthHistogram {
+		total += count
+	}
+	if total != stats.Nodes || stats.DepthHistogram[0] != 2 {
+		t.Errorf("depth histogram %v does not add up to %v nodes", stats.DepthHistogram, stats.Nodes)
+	}
+}
+
+func TestStatsRegistryLayer(t *testing.T) {
+	tree := NewTree(4)
+	tree.insert(&GeoPosition{Location: &GeoLocation{CityName: "Johannesburg", CountryISO: "ZA"}, Source: SourceGeoLite},
+		mustParseNetwork("41.0.0.0/17"))
+	tree.Registry = NewTree(4)
+	tree.Registry.insert(&GeoPosition{Location: &GeoLocation{CountryISO: "ZA"}, Source: SourceAFRINIC},
+		mustParseNetwork("41.0.0.0/16"), mustParseNetwork("2c0f:f000::/32"))
+	tree.Registry.insert(&GeoPosition{Location: &GeoLocation{CountryISO: "BR"}, Source: SourceLACNIC},
+		mustParseNetwork("200.0.0.0/24"))
+	tree.Registry.insert(&GeoPosition{Source: SourceLACNIC}, mustParseNetwork("200.0.0.0/22"))
+	stats := tree.Stats()
+
+	if afrinic := stats.Sources["afrinic"]; afrinic == nil || afrinic.Networks != 2 || afrinic.IPv4Addresses != 1<<15 ||
+		afrinic.IPv6Slash48s != 1<<16 {
+		t.Errorf("unexpected coverage for afrinic: %+v", afrinic)
+	}
+	if lacnic := stats.Sources["lacnic"]; lacnic == nil || lacnic.Networks != 2 || lacnic.IPv4Addresses != 1<<10 {
+		t.Errorf("unexpected coverage for lacnic: %+v", lacnic)
+	}
+	if za := stats.Countries["ZA"]; za == nil || za.IPv4Addresses != 1<<16 {
+		t.Errorf("address space resolved by GeoLite should not be counted again for the registry: %+v", za)
+	}
+	if br, unknown := stats.Countries["BR"], stats.Countries[""]; br == nil || br.IPv4Addresses != 1<<8 ||
+		unknown == nil || unknown.IPv4Addresses != 3<<8 {
+		t.Errorf("unexpected coverage for BR %+v and the registry region %+v", br, unknown)
+	}
+	if got, want := stats.CountryLevel.IPv4Percent, 100*float64(1<<15+1<<10)/(1<<32); got != want {
+		t.Errorf("country level IPv4 was %v%% instead of %v%%", got, want)
+	}
+	if n, _ := tree.LookupLayered(net.ParseIP("41.0.200.1")); n == nil || n.GeoPosition.Source != SourceAFRINIC {
+		t.Error("the registry layer should resolve the rest of 41.0.0.0/16")
+	}
+}
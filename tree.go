@@ -5,12 +5,13 @@ import (
 	"sort"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/demskie/subnetmath"
 )
 
 type Node struct {
-	Network     *net.IPNet
+	Network     Network
 	GeoPosition *GeoPosition
 	Parent      *Node
 	Children    []*Node
@@ -24,49 +25,77 @@ type Tree struct {
 	RootsV6   []*Node
 	Precision int
 	Size      int
+	Registry  *Tree                // RIR delegations consulted by LookupLayered where GeoLite has no position
+	ASNs      []ASNRecord          // RIR autonomous system delegations ordered by number
+	Serials   map[Source]time.Time // serial date of every delegated file that was ingested
+	Metadata  Metadata
+
+	spatial        *spatialIndex
+	locationIndex  *locationIndex
+	holderIndex    map[holderKey][]*Node
+	asnHolderIndex map[holderKey][]ASNRecord
+	trie           *atomic.Pointer[Trie]
+	cache          *atomic.Pointer[lookupCache]
+	special        *prefixIndex[*SpecialPurpose]
+	overrides      *prefixIndex[*Override]
+	overridden     []overriddenPosition
+	overridesMtx   *sync.Mutex // serializes SetOverrides, which rewrites the positions of nodes
 }
 
 // NewTree creates a new Tree object
 func NewTree(precision int) *Tree {
 	return &Tree{
-		mtx:       &sync.RWMutex{},
-		sbuf:      subnetmath.NewBuffer(),
-		Roots:     make([]*Node, 0),
-		RootsV6:   make([]*Node, 0),
-		Precision: precision,
-		Size:      0,
+		mtx:          &sync.RWMutex{},
+		sbuf:         subnetmath.NewBuffer(),
+		Roots:        make([]*Node, 0),
+		RootsV6:      make([]*Node, 0),
+		Precision:    precision,
+		Size:         0,
+		Metadata:     Metadata{FormatVersion: formatVersion},
+		special:      newSpecialRegistry(),
+		overrides:    newPrefixIndex[*Override](),
+		cache:        &atomic.Pointer[lookupCache]{},
+		trie:         &atomic.Pointer[Trie]{},
+		overridesMtx: &sync.Mutex{},
 	}
 }
 
-func (tree *Tree) insert(geoPosition *GeoPosition, networks ...*net.IPNet) {
+func (tree *Tree) insert(geoPosition *GeoPosition, networks ...Network) {
 	for _, network := range networks {
 		var parent *Node
-		if network.IP.To4() != nil {
+		if !network.IsV6() {
 			parent = tree.findClosestSupernet(network, tree.Roots)
 		} else {
 			parent = tree.findClosestSupernet(network, tree.RootsV6)
 		}
-		if parent != nil && subnetmath.NetworksAreIdentical(network, parent.Network) {
-			atomic.AddUint64(&counters.parentRate, 1)
+		if parent != nil && network == parent.Network {
 			if parent.GeoPosition == nil {
 				parent.GeoPosition = geoPosition
 			}
 		} else {
-			if parent != nil {
-				atomic.AddUint64(&counters.parentRate, 1)
-			} else {
-				atomic.AddUint64(&counters.noParentRate, 1)
-			}
 			insertNode(tree, &Node{Network: network, GeoPosition: geoPosition, Parent: parent, Children: nil})
 			tree.Size++
 		}
 	}
+	tree.modified()
+}
+
+// modified discards indexes that were derived from the previous contents of the tree
+func (tree *Tree) modified() {
+	tree.mtx.Lock()
+	tree.spatial = nil
+	tree.locationIndex = nil
+	tree.holderIndex = nil
+	tree.asnHolderIndex = nil
+	tree.trie.Store(nil)
+	tree.mtx.Unlock()
+	tree.purgeCache()
 }
 
 func insertNode(tree *Tree, newNode *Node) {
 	if newNode.Parent != nil {
 		for _, sibling := range newNode.Parent.Children {
-			if tree.sbuf.NetworkContainsSubnet(newNode.Network, sibling.Network) {
+			if newNode.Network.Contains(sibling.Network) {
 				newNode.Children = append(newNode.Children, sibling)
 			}
 		}
@@ -78,9 +107,9 @@ func insertNode(tree *Tree, newNode *Node) {
 		for len(newNode.Parent.Children) > tree.Precision {
 			splitParent(newNode.Parent, tree)
 		}
-	} else if newNode.Network.IP.To4() != nil {
+	} else if !newNode.Network.IsV6() {
 		for _, sibling := range tree.Roots {
-			if tree.sbuf.NetworkContainsSubnet(newNode.Network, sibling.Network) {
+			if newNode.Network.Contains(sibling.Network) {
 				newNode.Children = append(newNode.Children, sibling)
 			}
 		}
@@ -94,7 +123,7 @@ func insertNode(tree *Tree, newNode *Node) {
 		}
 	} else {
 		for _, sibling := range tree.RootsV6 {
-			if tree.sbuf.NetworkContainsSubnet(newNode.Network, sibling.Network) {
+			if newNode.Network.Contains(sibling.Network) {
 				newNode.Children = append(newNode.Children, sibling)
 			}
 		}
@@ -110,22 +139,24 @@ func insertNode(tree *Tree, newNode *Node) {
 }
 
 func splitParent(parent *Node, tree *Tree) {
-	copiedNetwork := subnetmath.DuplicateNetwork(parent.Network)
-	smallerNetwork := subnetmath.ShrinkNetwork(copiedNetwork)
-	if smallerNetwork != nil {
-		tree.insert(nil, smallerNetwork, subnetmath.NextNetwork(smallerNetwork))
+	lower, upper, ok := parent.Network.halves()
+	if ok {
+		tree.insert(nil, lower, upper)
 	}
 }
 
 func divideNodes(nodes []*Node, tree *Tree) {
-	lastAddr := subnetmath.BroadcastAddr(nodes[len(nodes)-1].Network)
-	subnets := tree.sbuf.FindInbetweenSubnets(nodes[0].Network.IP, lastAddr)
-	tree.insert(nil, subnets...)
+	lastAddr := subnetmath.BroadcastAddr(nodes[len(nodes)-1].Network.IPNet())
+	for _, subnet := range tree.sbuf.FindInbetweenSubnets(nodes[0].Network.IP(), lastAddr) {
+		if network, ok := NetworkFromIPNet(subnet); ok {
+			tree.insert(nil, network)
+		}
+	}
 }
 
 func (tree *Tree) insertIntoSortedNodes(slc []*Node, nd *Node) []*Node {
 	idx := sort.Search(len(slc), func(i int) bool {
-		return tree.sbuf.NetworkComesBefore(nd.Network, slc[i].Network)
+		return nd.Network.Before(slc[i].Network)
 	})
 	slc = append(slc, &Node{})
 	copy(slc[idx+1:], slc[idx:])
@@ -135,7 +166,7 @@ func (tree *Tree) insertIntoSortedNodes(slc []*Node, nd *Node) []*Node {
 
 func (tree *Tree) removeFromSortedNodes(slc []*Node, nd *Node) []*Node {
 	idx := sort.Search(len(slc), func(i int) bool {
-		return slc[i].Network.Contains(nd.Network.IP) || tree.sbuf.NetworkComesBefore(nd.Network, slc[i].Network)
+		return slc[i].Network.containsAddress(nd.Network) || nd.Network.Before(slc[i].Network)
 	})
 	if slc[idx] == nd {
 		copy(slc[idx:], slc[idx+1:])
@@ -145,24 +176,128 @@ func (tree *Tree) removeFromSortedNodes(slc []*Node, nd *Node) []*Node {
 	return slc
 }
 
-func (tree *Tree) findNetwork(address net.IP, nodes []*Node) *Node {
+// Lookup returns the most specific populated network that contains the address
+func (tree *Tree) Lookup(address net.IP) *Node {
+	cache := tree.lookupCache()
+	if cache == nil {
+		return tree.lookup(address)
+	}
+	host, ok := NetworkFromIP(address)
+	if !ok {
+		return nil
+	}
+	key := lookupKey{host: host}
+	result, generation, found := cache.get(key)
+	if !found {
+		result.node = tree.lookupHost(host)
+		cache.put(key, generation, result)
+	}
+	return result.node
+}
+
+func (tree *Tree) lookup(address net.IP) *Node {
+	host, ok := NetworkFromIP(address)
+	if !ok {
+		return nil
+	}
+	return tree.lookupHost(host)
+}
+
+func (tree *Tree) lookupHost(host Network) *Node {
+	for n := tree.lookupTrie().findClosestSupernet(host); n != nil; n = n.Parent {
+		if n.GeoPosition != nil {
+			return n
+		}
+	}
+	return nil
+}
+
+// LookupChain returns every populated network that contains the address ordered from root to leaf
+func (tree *Tree) LookupChain(address net.IP) []*Node {
+	var chain []*Node
+	for n := tree.findContaining(address); n != nil; n = n.Parent {
+		if n.GeoPosition != nil {
+			chain = append(chain, n)
+		}
+	}
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+	return chain
+}
+
+// Covering returns the closest populated network that is equal to or encloses the prefix
+func (tree *Tree) Covering(ipNet *net.IPNet) *Node {
+	network, ok := NetworkFromIPNet(ipNet)
+	if !ok {
+		return nil
+	}
+	for n := tree.lookupTrie().findClosestSupernet(network); n != nil; n = n.Parent {
+		if n.GeoPosition != nil {
+			return n
+		}
+	}
+	return nil
+}
+
+// Covered returns every populated network that falls within the prefix ordered by address
+func (tree *Tree) Covered(ipNet *net.IPNet) []*Node {
+	network, ok := NetworkFromIPNet(ipNet)
+	if !ok {
+		return nil
+	}
+	if network.IsV6() {
+		return appendCovered(nil, network, tree.RootsV6)
+	}
+	return appendCovered(nil, network, tree.Roots)
+}
+
+func appendCovered(result []*Node, network Network, nodes []*Node) []*Node {
 	idx := sort.Search(len(nodes), func(i int) bool {
-		return nodes[i].Network.Contains(address) || tree.sbuf.AddressComesBefore(address, nodes[i].Network.IP)
+		return !nodes[i].Network.lastAddress().Before(network)
 	})
-	if idx < len(nodes) {
-		if nodes[idx].Children != nil && len(nodes[idx].Children) > 0 {
-			return tree.findNetwork(address, nodes[idx].Children)
+	for ; idx < len(nodes); idx++ {
+		n := nodes[idx]
+		if !network.containsAddress(n.Network) && !n.Network.containsAddress(network) {
+			break
 		}
-		return nodes[idx]
+		if network.Contains(n.Network) && n.GeoPosition != nil {
+			result = append(result, n)
+		}
+		result = appendCovered(result, network, n.Children)
 	}
-	return nil
+	return result
+}
+
+func (tree *Tree) findContaining(address net.IP) *Node {
+	host, ok := NetworkFromIP(address)
+	if !ok {
+		return nil
+	}
+	return tree.lookupTrie().findClosestSupernet(host)
+}
+
+// lookupTrie returns the trie that lookups search instead of walking the sorted children of every node.
+// It is loaded without taking the lock so that lookups only contend while the trie is rebuilt.
+func (tree *Tree) lookupTrie() *Trie {
+	if trie := tree.trie.Load(); trie != nil {
+		return trie
+	}
+	tree.mtx.Lock()
+	defer tree.mtx.Unlock()
+	trie := tree.trie.Load()
+	if trie == nil {
+		trie = newTreeTrie(tree)
+		tree.trie.Store(trie)
+	}
+	return trie
 }
 
-func (tree *Tree) findClosestSupernet(network *net.IPNet, nodes []*Node) *Node {
+func (tree *Tree) findClosestSupernet(network Network, nodes []*Node) *Node {
 	idx := sort.Search(len(nodes), func(i int) bool {
-		return nodes[i].Network.Contains(network.IP) || tree.sbuf.NetworkComesBefore(network, nodes[i].Network)
+		return nodes[i].Network.containsAddress(network) || network.Before(nodes[i].Network)
 	})
-	if idx < len(nodes) && tree.sbuf.NetworkContainsSubnet(nodes[idx].Network, network) {
+	if idx < len(nodes) && nodes[idx].Network.Contains(network) {
 		if nodes[idx].Children != nil && len(nodes[idx].Children) > 0 {
 			canidateSupernet := tree.findClosestSupernet(network, nodes[idx].Children)
 			if canidateSupernet != nil {
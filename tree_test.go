@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestLookupChain(t *testing.T) {
+	allocation := &GeoPosition{Latitude: 1}
+	isp := &GeoPosition{Latitude: 2}
+	city := &GeoPosition{Latitude: 3}
+	tree := NewTree(2)
+	tree.insert(allocation, mustParseNetwork("24.0.0.0/12"))
+	tree.insert(isp, mustParseNetwork("24.1.0.0/16"))
+	tree.insert(city, mustParseNetwork("24.1.2.0/24"))
+	tree.insert(&GeoPosition{}, mustParseNetwork("24.1.3.0/24"), mustParseNetwork("24.1.4.0/24"), mustParseNetwork("24.1.8.0/24"))
+	chain := tree.LookupChain(net.ParseIP("24.1.2.3"))
+	if len(chain) != 3 || chain[0].GeoPosition != allocation || chain[1].GeoPosition != isp || chain[2].GeoPosition != city {
+		t.Fatal("unexpected chain", chain)
+	}
+	if n := tree.Lookup(net.ParseIP("24.1.2.3")); n != chain[2] {
+		t.Error("Lookup returned", n, "instead of the narrowest network")
+	}
+	if n := tree.Lookup(net.ParseIP("24.1.200.1")); n == nil || n.GeoPosition != isp {
+		t.Error("an address under a synthetic node did not resolve to its populated ancestor")
+	}
+	if chain := tree.LookupChain(net.ParseIP("25.0.0.1")); len(chain) != 0 {
+		t.Error("an address outside the tree returned", chain)
+	}
+}
+
+func TestCoveringAndCovered(t *testing.T) {
+	tree := NewTree(2)
+	for i, s := range []string{"24.0.0.0/12", "24.1.0.0/16", "24.1.2.0/24", "24.1.4.0/24", "24.2.0.0/16", "24.1.2.128/25"} {
+		tree.insert(&GeoPosition{Latitude: float64(i)}, mustParseNetwork(s))
+	}
+	tree.insert(nil, mustParseNetwork("24.1.8.0/24"))
+	if n := tree.Covering(mustParseNetwork("24.1.2.0/23").IPNet()); n == nil || n.Network != mustParseNetwork("24.1.0.0/16") {
+		t.Error("24.1.2.0/23 is covered by", n)
+	}
+	if n := tree.Covering(mustParseNetwork("24.1.2.0/24").IPNet()); n == nil || n.Network != mustParseNetwork("24.1.2.0/24") {
+		t.Error("24.1.2.0/24 is covered by", n)
+	}
+	if n := tree.Covering(mustParseNetwork("23.0.0.0/8").IPNet()); n != nil {
+		t.Error("23.0.0.0/8 is covered by", n)
+	}
+	var covered []string
+	for _, n := range tree.Covered(mustParseNetwork("24.1.0.0/16").IPNet()) {
+		covered = append(covered, n.Network.String())
+	}
+	if strings.Join(covered, " ") != "24.1.0.0/16 24.1.2.0/24 24.1.2.128/25 24.1.4.0/24" {
+		t.Error("24.1.0.0/16 covers", covered)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"net"
+)
+
+// Trie is a path-compressed binary trie keyed on fixed-width integer addresses. Nodes inserted
+// into a Trie do not track their Parent or Children, while a Trie built by newTreeTrie points at
+// the nodes of its Tree so that their ancestors can still be walked.
+type Trie struct {
+	root    *trieNode
+	rootV6  *trieNode
+	Size    int
+	slash16 []trieStart // where IPv4 searches resume after the first 16 bits, built by newTreeTrie
+}
+
+// trieStart is the first node that does not contain a whole /16 and the closest node that does
+type trieStart struct {
+	next  *trieNode
+	found *Node
+}
+
+type trieNode struct {
+	network Network
+	node    *Node
+	child   [2]*trieNode
+}
+
+// NewTrie creates a new Trie object
+func NewTrie() *Trie {
+	return &Trie{}
+}
+
+func (trie *Trie) insert(geoPosition *GeoPosition, networks ...Network) {
+	for _, network := range networks {
+		root := &trie.root
+		if network.IsV6() {
+			root = &trie.rootV6
+		}
+		if insertTrieNode(root, &Node{Network: network, GeoPosition: geoPosition}) {
+			trie.Size++
+		}
+	}
+}
+
+// newTreeTrie indexes every node of the tree including the synthetic ones
+func newTreeTrie(tree *Tree) *Trie {
+	trie := NewTrie()
+	var walk func(root **trieNode, nodes []*Node)
+	walk = func(root **trieNode, nodes []*Node) {
+		for _, n := range nodes {
+			if insertTrieNode(root, n) {
+				trie.Size++
+			}
+			walk(root, n.Children)
+		}
+	}
+	walk(&trie.root, tree.Roots)
+	walk(&trie.rootV6, tree.RootsV6)
+	trie.slash16 = make([]trieStart, 1<<16)
+	for i := range trie.slash16 {
+		prefix := Network{hi: uint64(i) << 48, ones: 16}
+		start := trieStart{next: trie.root}
+		// only nodes shorter than the prefix are shared by every address within it
+		for start.next != nil && start.next.network.ones < 16 && commonBits(start.next.network, prefix) >= start.next.network.ones {
+			if start.next.node != nil {
+				start.found = start.next.node
+			}
+			start.next = start.next.child[prefix.bit(start.next.network.ones)]
+		}
+		trie.slash16[i] = start
+	}
+	return trie
+}
+
+func insertTrieNode(pp **trieNode, newNode *Node) bool {
+	network := newNode.Network
+	for {
+		current := *pp
+		if current == nil {
+			*pp = &trieNode{network: network, node: newNode}
+			return true
+		}
+		common := commonBits(current.network, network)
+		if common > current.network.ones {
+			common = current.network.ones
+		}
+		if common > network.ones {
+			common = network.ones
+		}
+		if common == current.network.ones {
+			if common == network.ones {
+				if current.node == nil {
+					current.node = newNode
+					return true
+				}
+				if current.node.GeoPosition == nil {
+					current.node.GeoPosition = newNode.GeoPosition
+				}
+				return false
+			}
+			pp = &current.child[network.bit(current.network.ones)]
+			continue
+		}
+		branch := &trieNode{network: network.masked(common)}
+		if common == network.ones {
+			branch.node = newNode
+		} else {
+			branch.child[network.bit(common)] = &trieNode{network: network, node: newNode}
+		}
+		branch.child[current.network.bit(common)] = current
+		*pp = branch
+		return true
+	}
+}
+
+func (trie *Trie) findNetwork(address net.IP) *Node {
+	host, ok := NetworkFromIP(address)
+	if !ok {
+		return nil
+	}
+	return trie.findClosestSupernet(host)
+}
+
+func (trie *Trie) findClosestSupernet(network Network) *Node {
+	start := trieStart{next: trie.root}
+	if network.IsV6() {
+		start.next = trie.rootV6
+	} else if trie.slash16 != nil && network.ones >= 16 {
+		start = trie.slash16[network.hi>>48]
+	}
+	current, found := start.next, start.found
+	// both roots hold a single family so a node contains the network when their leading bits agree
+	for current != nil && current.network.ones <= network.ones && commonBits(current.network, network) >= current.network.ones {
+		if current.node != nil {
+			found = current.node
+		}
+		current = current.child[network.bit(current.network.ones)]
+	}
+	return found
+}
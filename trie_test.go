@@ -0,0 +1,160 @@
+package main
+
+import (
+	"math/rand"
+	"net"
+	"testing"
+)
+
+var benchTrie *Trie
+
+func createBenchTrie(b *testing.B) *Trie {
+	skipWithoutGeolite(b)
+	if benchTrie == nil {
+		benchTrie = NewTrie()
+		reader := newGeoliteReader(getAllGeoLocations(NewTree(128)), cityBlocksV4Path, cityBlocksV6Path)
+		for network, geoPosition, ok := reader.next(); ok; network, geoPosition, ok = reader.next() {
+			benchTrie.insert(geoPosition, network)
+		}
+	}
+	return benchTrie
+}
+
+func randomNetwork(r *rand.Rand, minOnes, maxOnes int) Network {
+	ones := minOnes + r.Intn(maxOnes-minOnes+1)
+	mask := net.CIDRMask(ones, 32)
+	ip := net.IPv4(byte(r.Intn(4)), byte(r.Intn(256)), byte(r.Intn(256)), byte(r.Intn(256))).To4()
+	network, _ := NetworkFromIPNet(&net.IPNet{IP: ip.Mask(mask), Mask: mask})
+	return network
+}
+
+func TestTrieMatchesLongestPrefix(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	trie := NewTrie()
+	var networks []Network
+	for i := 0; i < 2000; i++ {
+		network := randomNetwork(r, 4, 28)
+		networks = append(networks, network)
+		trie.insert(&GeoPosition{Latitude: float64(i)}, network)
+	}
+	longest := func(contains func(Network) bool) *Network {
+		var best *Network
+		for i, network := range networks {
+			if contains(network) && (best == nil || best.Contains(network)) {
+				best = &networks[i]
+			}
+		}
+		return best
+	}
+	for i := 0; i < 5000; i++ {
+		addr := net.IPv4(byte(r.Intn(4)), byte(r.Intn(256)), byte(r.Intn(256)), byte(r.Intn(256)))
+		expected := longest(func(n Network) bool { return n.ContainsIP(addr) })
+		result := trie.findNetwork(addr)
+		if (expected == nil) != (result == nil) || (result != nil && result.Network != *expected) {
+			t.Fatalf("findNetwork(%v) returned %v instead of %v", addr, result, expected)
+		}
+		network := randomNetwork(r, 8, 32)
+		expected = longest(func(n Network) bool { return n.Contains(network) })
+		result = trie.findClosestSupernet(network)
+		if (expected == nil) != (result == nil) || (result != nil && result.Network != *expected) {
+			t.Fatalf("findClosestSupernet(%v) returned %v instead of %v", network, result, expected)
+		}
+	}
+}
+
+func TestTrieLookupsDoNotAllocate(t *testing.T) {
+	trie := NewTrie()
+	trie.insert(nil, mustParseNetwork("185.48.0.0/16"), mustParseNetwork("2001:db8::/32"))
+	addr, addrV6 := net.ParseIP("185.48.252.0"), net.ParseIP("2001:db8::1")
+	network := mustParseNetwork("185.48.252.0/22")
+	allocs := testing.AllocsPerRun(100, func() {
+		trie.findNetwork(addr)
+		trie.findNetwork(addrV6)
+		trie.findClosestSupernet(network)
+	})
+	if allocs != 0 {
+		t.Error("lookups allocated", allocs, "times")
+	}
+}
+
+func BenchmarkTrieFindNetwork(b *testing.B) {
+	trie := createBenchTrie(b)
+	addr := net.ParseIP("185.48.252.0")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		trie.findNetwork(addr)
+	}
+}
+
+func BenchmarkTrieFindClosestSupernet(b *testing.B) {
+	trie := createBenchTrie(b)
+	network := mustParseNetwork("185.48.252.0/22")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		trie.findClosestSupernet(network)
+	}
+}
+
+// lookupByChildren is the search that Tree.Lookup made before it was backed by a trie
+func lookupByChildren(tree *Tree, address net.IP) *Node {
+	host, _ := NetworkFromIP(address)
+	roots := tree.Roots
+	if host.IsV6() {
+		roots = tree.RootsV6
+	}
+	for n := tree.findClosestSupernet(host, roots); n != nil; n = n.Parent {
+		if n.GeoPosition != nil {
+			return n
+		}
+	}
+	return nil
+}
+
+func TestTreeLookupUsesTrie(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	tree := NewTree(4)
+	for i := 0; i < 2000; i++ {
+		tree.insert(&GeoPosition{Latitude: float64(i)}, randomNetwork(r, 4, 28))
+	}
+	tree.insert(&GeoPosition{Latitude: -1}, mustParseNetwork("2001:db8::/32"), mustParseNetwork("2001:db8:1::/48"))
+	for i := 0; i < 5000; i++ {
+		addr := net.IPv4(byte(r.Intn(4)), byte(r.Intn(256)), byte(r.Intn(256)), byte(r.Intn(256)))
+		if n, expected := tree.Lookup(addr), lookupByChildren(tree, addr); n != expected {
+			t.Fatalf("Lookup(%v) returned %v instead of %v", addr, n, expected)
+		}
+	}
+	if n := tree.Lookup(net.ParseIP("2001:db8:1::1")); n == nil || n.Network != mustParseNetwork("2001:db8:1::/48") {
+		t.Error("unexpected IPv6 lookup", n)
+	}
+	tree.insert(&GeoPosition{Latitude: -2}, mustParseNetwork("3.1.2.3/32"))
+	if n := tree.Lookup(net.ParseIP("3.1.2.3")); n == nil || n.GeoPosition.Latitude != -2 {
+		t.Error("the trie was not rebuilt after an insert", n)
+	}
+}
+
+func BenchmarkLookup(b *testing.B) {
+	r := rand.New(rand.NewSource(1))
+	tree := NewTree(32)
+	for i := 0; i < 100000; i++ {
+		tree.insert(&GeoPosition{Latitude: float64(i)}, randomNetwork(r, 12, 28))
+	}
+	addresses := make([]net.IP, 1024)
+	for i := range addresses {
+		addresses[i] = net.IPv4(byte(r.Intn(4)), byte(r.Intn(256)), byte(r.Intn(256)), byte(r.Intn(256)))
+	}
+	b.Run("children", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			lookupByChildren(tree, addresses[i%len(addresses)])
+		}
+	})
+	tree.lookupTrie()
+	b.Run("trie", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			tree.Lookup(addresses[i%len(addresses)])
+		}
+	})
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// delegatedMirrors holds the directory that each delegated file is published in
+var delegatedMirrors = map[string]string{
+	arinPath:    "https://ftp.arin.net/pub/stats/arin/",
+	ripePath:    "https://ftp.ripe.net/ripe/stats/",
+	apnicPath:   "http://ftp.apnic.net/stats/apnic/",
+	afrinicPath: "http://ftp.apnic.net/stats/afrinic/",
+	lacnicPath:  "https://ftp.lacnic.net/pub/stats/lacnic/",
+}
+
+const geoliteDownloadURL = "https://download.maxmind.com/app/geoip_download?edition_id=GeoLite2-City-CSV"
+
+var geolitePaths = []string{cityLocationsPath, cityBlocksV4Path, cityBlocksV6Path}
+
+// updater downloads and verifies every input file before moving them into place. When one of the
+// files cannot be moved the ones already moved are put back so the previous set stays whole.
+type updater struct {
+	client     *http.Client
+	baseURL    string        // replaces the scheme and host of every mirror when set
+	licenseKey string        // GeoLite2 is skipped when empty
+	maxAge     time.Duration // delegated files with an older serial are rejected, zero to accept any
+	gopath     string
+	rename     func(oldpath, newpath string) error // os.Rename when nil
+}
+
+func updateCommand(args []string) {
+	flags := flag.NewFlagSet("update", flag.ContinueOnError)
+	baseURL := flags.String("base-url", "", "fetch every file from this mirror instead of the registries and MaxMind")
+	licenseKey := flags.String("license-key", os.Getenv("MAXMIND_LICENSE_KEY"), "MaxMind license key for GeoLite2")
+	maxAge := flags.Duration("max-age", 7*24*time.Hour, "reject delegated files with an older serial, zero to accept any")
+	parseFlags(flags, args)
+	gopath, _ := os.LookupEnv("GOPATH")
+	u := &updater{
+		client:     &http.Client{Timeout: 10 * time.Minute},
+		baseURL:    *baseURL,
+		licenseKey: *licenseKey,
+		maxAge:     *maxAge,
+		gopath:     gopath,
+	}
+	if err := u.update(); err != nil {
+		fatalf("unable to update input data because: %v", err)
+	}
+}
+
+func (u *updater) update() error {
+	dir := path.Join(u.gopath, basePath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	staging, err := os.MkdirTemp(dir, ".staging-")
+	if err != nil {
+		return err
+	}
+	keepStaging := false
+	defer func() {
+		if !keepStaging {
+			os.RemoveAll(staging)
+		}
+	}()
+	var staged []string
+	for _, delegatedPath := range delegatedPaths {
+		name := path.Base(delegatedPath)
+		mirror, err := u.resolve(delegatedMirrors[delegatedPath] + name)
+		if err != nil {
+			return err
+		}
+		if err := u.fetchVerified(mirror, mirror+".md5", path.Join(staging, name), md5.New()); err != nil {
+			return fmt.Errorf("%v: %v", name, err)
+		}
+		registry := strings.Split(strings.TrimPrefix(name, "delegated-"), "-")[0]
+		if err := checkDelegatedFile(path.Join(staging, name), registry, u.maxAge); err != nil {
+			return fmt.Errorf("%v: %v", name, err)
+		}
+		staged = append(staged, delegatedPath)
+	}
+	if u.licenseKey == "" {
+		log.Printf("skipping GeoLite2 because no license key was given")
+	} else {
+		mirror, err := u.resolve(geoliteDownloadURL + "&license_key=" + url.QueryEscape(u.licenseKey))
+		if err != nil {
+			return err
+		}
+		zipPath := path.Join(staging, "GeoLite2-City-CSV.zip")
+		if err := u.fetchVerified(mirror+"&suffix=zip", mirror+"&suffix=zip.sha256", zipPath, sha256.New()); err != nil {
+			return fmt.Errorf("GeoLite2-City-CSV.zip: %v", err)
+		}
+		if err := extractGeolite(zipPath, staging); err != nil {
+			return fmt.Errorf("GeoLite2-City-CSV.zip: %v", err)
+		}
+		staged = append(staged, geolitePaths...)
+	}
+	if err := u.install(staging, staged); err != nil {
+		if rollbackErr := u.rollback(staging, staged); rollbackErr != nil {
+			keepStaging = true
+			return fmt.Errorf("%v and the previous files could not be restored from %v: %v", err, staging, rollbackErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// install moves the previous files aside into the staging directory and the staged files into place
+func (u *updater) install(staging string, staged []string) error {
+	if err := os.Mkdir(path.Join(staging, "previous"), 0755); err != nil {
+		return err
+	}
+	for _, stagedPath := range staged {
+		name := path.Base(stagedPath)
+		target := path.Join(u.gopath, stagedPath)
+		if err := u.renameFile(target, path.Join(staging, "previous", name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err := u.renameFile(path.Join(staging, name), target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rollback puts back the previous files that install moved aside and removes the files that had none
+func (u *updater) rollback(staging string, staged []string) error {
+	var failed error
+	for _, stagedPath := range staged {
+		name := path.Base(stagedPath)
+		target := path.Join(u.gopath, stagedPath)
+		previous := path.Join(staging, "previous", name)
+		if _, err := os.Stat(previous); err == nil {
+			if err := u.renameFile(previous, target); err != nil {
+				failed = err
+			}
+		} else if _, err := os.Stat(path.Join(staging, name)); os.IsNotExist(err) {
+			os.Remove(target) // the new file was moved into place where there was none before
+		}
+	}
+	return failed
+}
+
+func (u *updater) renameFile(oldpath, newpath string) error {
+	if u.rename != nil {
+		return u.rename(oldpath, newpath)
+	}
+	return os.Rename(oldpath, newpath)
+}
+
+// resolve points a mirror at the base URL when one was given
+func (u *updater) resolve(rawURL string) (string, error) {
+	if u.baseURL == "" {
+		return rawURL, nil
+	}
+	base, err := url.Parse(u.baseURL)
+	if err != nil {
+		return "", err
+	}
+	mirror, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	mirror.Scheme, mirror.Host = base.Scheme, base.Host
+	mirror.Path = strings.TrimSuffix(base.Path, "/") + mirror.Path
+	return mirror.String(), nil
+}
+
+var hexDigest = regexp.MustCompile(`[0-9a-fA-F]+`)
+
+// fetchVerified downloads a file and compares its digest against the one published next to it
+func (u *updater) fetchVerified(fileURL, checksumURL, destination string, digest hash.Hash) error {
+	var checksum strings.Builder
+	if err := u.fetch(checksumURL, &checksum); err != nil {
+		return err
+	}
+	expected := ""
+	for _, candidate := range hexDigest.FindAllString(checksum.String(), -1) {
+		if len(candidate) == 2*digest.Size() {
+			expected = strings.ToLower(candidate)
+		}
+	}
+	if expected == "" {
+		return fmt.Errorf("no checksum found in %q", checksum.String())
+	}
+	f, err := os.Create(destination)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := u.fetch(fileURL, io.MultiWriter(f, digest)); err != nil {
+		return err
+	}
+	if actual := hex.EncodeToString(digest.Sum(nil)); actual != expected {
+		return fmt.Errorf("checksum %v does not match the published %v", actual, expected)
+	}
+	return f.Close()
+}
+
+func (u *updater) fetch(fileURL string, w io.Writer) error {
+	resp, err := u.client.Get(fileURL)
+	if urlError, ok := err.(*url.Error); ok {
+		err = urlError.Err // the url may contain the license key
+	}
+	if err != nil {
+		return fmt.Errorf("unable to download because: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("download failed with status %v", resp.Status)
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// extractGeolite copies the CSV files that the ingest reads out of a GeoLite2 archive
+func extractGeolite(zipPath, dir string) error {
+	archive, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+	for _, geolitePath := range geolitePaths {
+		name := path.Base(geolitePath)
+		var entry *zip.File
+		for _, f := range archive.File {
+			if path.Base(f.Name) == name {
+				entry = f
+			}
+		}
+		if entry == nil {
+			return fmt.Errorf("%v is missing from the archive", name)
+		}
+		src, err := entry.Open()
+		if err != nil {
+			return err
+		}
+		dst, err := os.Create(path.Join(dir, name))
+		if err == nil {
+			_, err = io.Copy(dst, src)
+			dst.Close()
+		}
+		src.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkDelegatedFile validates the version and summary lines of a downloaded delegated file
+func checkDelegatedFile(delegatedPath string, registry string, maxAge time.Duration) error {
+	txtFile, err := os.Open(delegatedPath)
+	if err != nil {
+		return err
+	}
+	defer txtFile.Close()
+	validator := &delegatedValidator{}
+	scanner := bufio.NewScanner(txtFile)
+	for scanner.Scan() {
+		if _, err := validator.check(strings.Split(scanner.Text(), "|")); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if err := validator.finish(); err != nil {
+		return err
+	}
+	if validator.registry != registry {
+		return fmt.Errorf("file was published by '%v' instead of '%v'", validator.registry, registry)
+	}
+	if maxAge > 0 && time.Since(validator.serial) > maxAge {
+		return fmt.Errorf("serial %v is older than %v", validator.serial.Format("20060102"), maxAge)
+	}
+	return nil
+}
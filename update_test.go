@@ -0,0 +1,160 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func delegatedFixture(registry string) string {
+	return "2.3|" + registry + "|20190106|3|19870101|20190104|-0200\n" +
+		registry + "|*|asn|*|1|summary\n" +
+		registry + "|*|ipv4|*|1|summary\n" +
+		registry + "|*|ipv6|*|1|summary\n" +
+		registry + "|ZA|asn|1228|1|19910301|allocated|A\n" +
+		registry + "|ZA|ipv4|41.0.0.0|65536|20070409|allocated|A\n" +
+		registry + "|ZA|ipv6|2c0f:f000::|32|20070410|allocated|A\n"
+}
+
+func newMirror(t *testing.T, files map[string]string) *httptest.Server {
+	var archive bytes.Buffer
+	writer := zip.NewWriter(&archive)
+	for _, geolitePath := range geolitePaths {
+		f, _ := writer.Create("GeoLite2-City-CSV_20190101/" + path.Base(geolitePath))
+		f.Write([]byte(path.Base(geolitePath)))
+	}
+	writer.Close()
+	mux := http.NewServeMux()
+	for name, contents := range files {
+		contents := contents
+		mux.HandleFunc("/"+name, func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(contents)) })
+		if _, exists := files[name+".md5"]; !exists && !strings.HasSuffix(name, ".md5") {
+			mux.HandleFunc("/"+name+".md5", func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprintf(w, "MD5 (%v) = %x\n", path.Base(name), md5.Sum([]byte(contents)))
+			})
+		}
+	}
+	mux.HandleFunc("/app/geoip_download", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("license_key") != "secret" {
+			http.Error(w, "invalid license key", http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Query().Get("suffix") {
+		case "zip":
+			w.Write(archive.Bytes())
+		case "zip.sha256":
+			fmt.Fprintf(w, "%x  GeoLite2-City-CSV_20190101.zip\n", sha256.Sum256(archive.Bytes()))
+		}
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func mirrorFiles() map[string]string {
+	files := map[string]string{}
+	for _, delegatedPath := range delegatedPaths {
+		mirror := strings.SplitN(delegatedMirrors[delegatedPath], "/", 4)[3]
+		name := path.Base(delegatedPath)
+		files[mirror+name] = delegatedFixture(strings.Split(strings.TrimPrefix(name, "delegated-"), "-")[0])
+	}
+	return files
+}
+
+func TestUpdate(t *testing.T) {
+	server := newMirror(t, mirrorFiles())
+	gopath := t.TempDir()
+	u := &updater{client: server.Client(), baseURL: server.URL, licenseKey: "secret", gopath: gopath}
+	if err := u.update(); err != nil {
+		t.Fatal(err)
+	}
+	for _, delegatedPath := range delegatedPaths {
+		if b, err := os.ReadFile(path.Join(gopath, delegatedPath)); err != nil || !strings.HasSuffix(string(b), "allocated|A\n") {
+			t.Errorf("%v was not updated: %v", delegatedPath, err)
+		}
+	}
+	for _, geolitePath := range geolitePaths {
+		if b, err := os.ReadFile(path.Join(gopath, geolitePath)); err != nil || string(b) != path.Base(geolitePath) {
+			t.Errorf("%v was not extracted: %v", geolitePath, err)
+		}
+	}
+	entries, _ := os.ReadDir(path.Join(gopath, basePath))
+	if len(entries) != len(delegatedPaths)+len(geolitePaths) {
+		t.Errorf("staging files were left behind: %v", entries)
+	}
+
+	u.maxAge = 24 * time.Hour
+	if err := u.update(); err == nil || !strings.Contains(err.Error(), "older") {
+		t.Errorf("files with a stale serial should be rejected: %v", err)
+	}
+
+	u.maxAge = 0
+	u.licenseKey = "wrong"
+	if err := u.update(); err == nil || strings.Contains(err.Error(), "wrong") {
+		t.Errorf("an invalid license key should fail without leaking the key: %v", err)
+	}
+}
+
+func TestUpdateLeavesFilesOnFailure(t *testing.T) {
+	for name, corrupt := range map[string]func(files map[string]string, key string){
+		"checksum": func(files map[string]string, key string) {
+			files[key+".md5"] = "MD5 (file) = 00000000000000000000000000000000"
+		},
+		"summary": func(files map[string]string, key string) {
+			files[key] = strings.Replace(files[key], "|ipv4|*|1|", "|ipv4|*|2|", 1)
+		},
+	} {
+		files := mirrorFiles()
+		key := "pub/stats/lacnic/delegated-lacnic-extended-latest"
+		corrupt(files, key)
+		server := newMirror(t, files)
+		gopath := t.TempDir()
+		os.MkdirAll(path.Join(gopath, basePath), 0755)
+		os.WriteFile(path.Join(gopath, arinPath), []byte("previous"), 0644)
+		u := &updater{client: server.Client(), baseURL: server.URL, gopath: gopath}
+		if err := u.update(); err == nil || !strings.Contains(err.Error(), "lacnic") {
+			t.Errorf("a bad %v should fail the update but returned: %v", name, err)
+		}
+		if b, _ := os.ReadFile(path.Join(gopath, arinPath)); string(b) != "previous" {
+			t.Errorf("a bad %v replaced files that had already been verified", name)
+		}
+		if entries, _ := os.ReadDir(path.Join(gopath, basePath)); len(entries) != 1 {
+			t.Errorf("a bad %v left staging files behind: %v", name, entries)
+		}
+	}
+}
+
+func TestUpdateRestoresFilesWhenMovingFails(t *testing.T) {
+	server := newMirror(t, mirrorFiles())
+	gopath := t.TempDir()
+	os.MkdirAll(path.Join(gopath, basePath), 0755)
+	os.WriteFile(path.Join(gopath, arinPath), []byte("previous"), 0644)
+	os.WriteFile(path.Join(gopath, cityBlocksV4Path), []byte("previous"), 0644)
+	u := &updater{client: server.Client(), baseURL: server.URL, licenseKey: "secret", gopath: gopath}
+	u.rename = func(oldpath, newpath string) error {
+		if newpath == path.Join(gopath, cityBlocksV6Path) {
+			return fmt.Errorf("no space left on device")
+		}
+		return os.Rename(oldpath, newpath)
+	}
+	if err := u.update(); err == nil || !strings.Contains(err.Error(), "no space") {
+		t.Fatalf("the failed move should fail the update but returned: %v", err)
+	}
+	for _, previousPath := range []string{arinPath, cityBlocksV4Path} {
+		if b, _ := os.ReadFile(path.Join(gopath, previousPath)); string(b) != "previous" {
+			t.Errorf("%v was not restored", previousPath)
+		}
+	}
+	if entries, _ := os.ReadDir(path.Join(gopath, basePath)); len(entries) != 2 {
+		t.Errorf("files without a previous version or staging files were left behind: %v", entries)
+	}
+}